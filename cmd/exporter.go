@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/hidracloud/hidra/v3/config"
 	"github.com/hidracloud/hidra/v3/internal/exporter"
+	"github.com/hidracloud/hidra/v3/internal/plugins/external"
 	"github.com/hidracloud/hidra/v3/internal/utils"
 	"github.com/hidracloud/hidra/v3/report"
 	log "github.com/sirupsen/logrus"
@@ -30,6 +31,21 @@ var exporterCmd = &cobra.Command{
 		// Set log level
 		utils.SetLogLevelFromStr(exporterConf.LogLevel)
 
+		// Load external plugins
+		if exporterConf.PluginsPath != "" {
+			err = external.LoadPlugins(exporterConf.PluginsPath)
+
+			if err != nil {
+				log.Fatal("error loading external plugins: ", err)
+			}
+
+			// Stop the plugin processes when the exporter exits
+			exporter.OnShutdown(external.StopPlugins)
+		}
+
+		// Set samples root, defaults files and libraries are searched up to it
+		exporterConf.SetSamplesPaths()
+
 		// Set report mode
 		if exporterConf.ReportConfig.Enabled {
 			report.IsEnabled = true
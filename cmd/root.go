@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 
+	"github.com/hidracloud/hidra/v3/config"
 	"github.com/spf13/cobra"
 )
 
@@ -12,6 +13,8 @@ var (
 	stressDuration string
 	stressThreads  int
 	runBgTasks     bool
+	pluginsPath    string
+	libraryPath    string
 
 	// configNotFoundErr is the error returned when the config file is not found.
 	configNotFoundErr = "config file not found"
@@ -46,9 +49,15 @@ func init() {
 
 	testCmd.PersistentFlags().BoolVar(&exitOnError, "exit-on-error", false, "Exit with error code 1 if any test fails")
 	testCmd.PersistentFlags().BoolVar(&runBgTasks, "run-bg-tasks", false, "Run background tasks")
+	testCmd.PersistentFlags().StringVar(&pluginsPath, "plugins-path", "", "Path to the external plugins")
+	testCmd.PersistentFlags().StringVar(&config.LibraryPath, "library-path", "", "Path to the step fragments, by default the closest library directory")
+	testCmd.PersistentFlags().StringVar(&config.SamplesPath, "samples-path", "", "Root directory of the samples, defaults files are searched up to it")
 
 	rootCmd.AddCommand(testCmd)
 	rootCmd.AddCommand(versionCmd)
+	verifyCmd.PersistentFlags().StringVar(&pluginsPath, "plugins-path", "", "Path to the external plugins")
+	verifyCmd.PersistentFlags().StringVar(&config.LibraryPath, "library-path", "", "Path to the step fragments, by default the closest library directory")
+	verifyCmd.PersistentFlags().StringVar(&config.SamplesPath, "samples-path", "", "Root directory of the samples, defaults files are searched up to it")
 	rootCmd.AddCommand(verifyCmd)
 
 	stressCmd.PersistentFlags().StringVar(&stressDuration, "duration", "60s", "Duration of the stress test")
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/hidracloud/hidra/v3/config"
+	"github.com/hidracloud/hidra/v3/internal/plugins/external"
 	"github.com/hidracloud/hidra/v3/internal/runner"
 	"github.com/hidracloud/hidra/v3/internal/utils"
 	"github.com/spf13/cobra"
@@ -32,6 +33,14 @@ var testCmd = &cobra.Command{
 			log.Debug("Setting up browser in headless mode")
 		}
 
+		if pluginsPath != "" {
+			err := external.LoadPlugins(pluginsPath)
+
+			if err != nil {
+				log.Fatal("error loading external plugins: ", err)
+			}
+		}
+
 		for _, sample := range args {
 			// Load sample config
 			sampleConf, err := config.LoadSampleConfigFromFile(sample)
@@ -90,6 +99,7 @@ var testCmd = &cobra.Command{
 			}
 		}
 
+		external.StopPlugins()
 		os.Exit(exitCode)
 	},
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/hidracloud/hidra/v3/config"
+	"github.com/hidracloud/hidra/v3/internal/plugins/external"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -18,14 +19,24 @@ var verifyCmd = &cobra.Command{
 		exitCode := 0
 		log.SetLevel(log.DebugLevel)
 
+		if pluginsPath != "" {
+			err := external.LoadPlugins(pluginsPath)
+
+			if err != nil {
+				log.Fatal("error loading external plugins: ", err)
+			}
+		}
+
 		errorCount := 0
 		for _, sample := range args {
 			// load sample config
 			sampleConf, err := config.LoadSampleConfigFromFile(sample)
 
 			if err != nil {
-				log.Errorf("❌ Problems loading %s, error: %s", sample, err)
-				errorCount++
+				for _, oneErr := range unwrapErrors(err) {
+					log.Errorf("❌ Problems loading %s, error: %s", sample, oneErr)
+					errorCount++
+				}
 				continue
 			}
 
@@ -33,8 +44,10 @@ var verifyCmd = &cobra.Command{
 			err = sampleConf.Verify()
 
 			if err != nil {
-				log.Errorf("❌ Problems verifying %s, error: %s", sample, err)
-				errorCount++
+				for _, oneErr := range unwrapErrors(err) {
+					log.Errorf("❌ Problems verifying %s, error: %s", sample, oneErr)
+					errorCount++
+				}
 				continue
 			}
 
@@ -48,6 +61,16 @@ var verifyCmd = &cobra.Command{
 			log.Infof("✅ No errors found")
 		}
 
+		external.StopPlugins()
 		os.Exit(exitCode)
 	},
 }
+
+// unwrapErrors returns the errors joined in err.
+func unwrapErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+
+	return []error{err}
+}
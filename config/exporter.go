@@ -43,6 +43,13 @@ type ExporterConfig struct {
 	// SamplesPath is the path to the samples.
 	SamplesPath string `yaml:"samples_path"`
 
+	// PluginsPath is the path to the external plugins.
+	PluginsPath string `yaml:"plugins_path"`
+
+	// LibraryPath is the path to the step fragments. Defaults to the closest library directory of each
+	// sample, see FindLibraryPath.
+	LibraryPath string `yaml:"library_path"`
+
 	// SchedulerConfig is the configuration for the scheduler.
 	SchedulerConfig struct {
 		// RefreshSamplesInterval is the interval to refresh the samples.
@@ -160,3 +167,10 @@ func LoadExporterConfigFromFile(path string) (*ExporterConfig, error) {
 	}
 	return LoadExporterConfig(data)
 }
+
+// SetSamplesPaths sets the samples root and the step fragments library used to load the samples. Without
+// library path, the library of each sample is found like in hidra verify.
+func (c *ExporterConfig) SetSamplesPaths() {
+	SamplesPath = c.SamplesPath
+	LibraryPath = c.LibraryPath
+}
@@ -0,0 +1,310 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LibraryDirName is the name of the directory of step fragments, next to the samples directory.
+	LibraryDirName = "library"
+)
+
+var (
+	// LibraryPath is the directory of the step fragments. If empty, the closest library directory
+	// in the directories of the sample up to SamplesPath, or next to the outermost one, is used.
+	LibraryPath = ""
+
+	// fragmentParamRegexp matches the ${name} placeholders of the fragment parameters.
+	fragmentParamRegexp = regexp.MustCompile(`\$\{(\w+)\}`)
+)
+
+// FragmentConfig is a named list of steps, included by the samples.
+type FragmentConfig struct {
+	// Description is the description of the fragment.
+	Description string `yaml:"description,omitempty"`
+	// Parameters are the parameters of the fragment with their default value. Parameters without
+	// default value are required.
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+	// Steps is the steps of the fragment. ${name} is replaced by the parameter value.
+	Steps []StepConfig `yaml:"steps,omitempty"`
+}
+
+// LoadFragmentConfigFromFile loads a fragment from file.
+func LoadFragmentConfigFromFile(path string) (*FragmentConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fragment FragmentConfig
+	err = yaml.Unmarshal(data, &fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fragment, nil
+}
+
+// FindLibraryPath returns the library directory used by a sample. The directories of the sample are
+// searched up to SamplesPath, and the library can also be next to the outermost one, like
+// samples/ and library/. Without SamplesPath, only the sample directory and its parent are searched.
+func FindLibraryPath(samplePath string) string {
+	if LibraryPath != "" {
+		return LibraryPath
+	}
+
+	dirs := sampleDirs(samplePath)
+
+	if len(dirs) == 0 {
+		return ""
+	}
+
+	dirs = append(dirs, filepath.Dir(dirs[len(dirs)-1]))
+
+	for _, dir := range dirs {
+		library := filepath.Join(dir, LibraryDirName)
+
+		if info, err := os.Stat(library); err == nil && info.IsDir() {
+			return library
+		}
+	}
+
+	return ""
+}
+
+// ResolveIncludes replaces the include steps with the steps of the fragments in the library.
+func (c *SampleConfig) ResolveIncludes(library string) error {
+	steps, errs := resolveIncludes(c.Path+"#", c.Steps, library, nil, nil)
+	c.Steps = steps
+
+	for _, hook := range SampleHooks {
+		hookSteps, hookErrs := resolveIncludes(fmt.Sprintf("%s#hooks.%s.", c.Path, hook), c.Hooks.Get(hook), library, nil, nil)
+		c.Hooks.Set(hook, hookSteps)
+		errs = append(errs, hookErrs...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// resolveIncludes expands the include steps. Stack is the list of fragments being included, to detect
+// cycles, and params are the parameters of the current fragment, if any.
+func resolveIncludes(prefix string, steps []StepConfig, library string, stack []string, params map[string]string) ([]StepConfig, []error) {
+	resolved := []StepConfig{}
+	errs := []error{}
+
+	for i, step := range steps {
+		stepErr := func(err error) {
+			errs = append(errs, fmt.Errorf("%s%d: %w", prefix, i, err))
+		}
+
+		step.When = replaceFragmentParam(step.When, params)
+		step.Register = replaceRegisterParams(step.Register, params)
+
+		if step.Repeat != nil {
+			repeat := *step.Repeat
+			repeat.Until = replaceFragmentParam(repeat.Until, params)
+			step.Repeat = &repeat
+		}
+
+		if step.Include == "" {
+			var childErrs []error
+
+			step.Plugin = replaceFragmentParam(step.Plugin, params)
+			step.Action = replaceFragmentParam(step.Action, params)
+			step.Parameters = replaceFragmentParams(step.Parameters, params)
+			step.Parallel, childErrs = resolveIncludes(fmt.Sprintf("%s%d.", prefix, i), step.Parallel, library, stack, params)
+			errs = append(errs, childErrs...)
+			step.Steps, childErrs = resolveIncludes(fmt.Sprintf("%s%d.", prefix, i), step.Steps, library, stack, params)
+			errs = append(errs, childErrs...)
+
+			resolved = append(resolved, step)
+			continue
+		}
+
+		if step.Plugin != "" || step.Action != "" || step.IsGroup() || len(step.Parameters) > 0 {
+			stepErr(fmt.Errorf("include can't be used with plugin, action, parameters, parallel or steps"))
+			continue
+		}
+
+		if len(step.Register) > 0 || step.Negate || step.IgnoreOnError || step.Timeout > 0 {
+			stepErr(fmt.Errorf("include can't be used with register, negate, ignoreOnError or timeout, set them on the steps of the fragment"))
+			continue
+		}
+
+		if slices.Contains(stack, step.Include) {
+			stepErr(fmt.Errorf("include cycle %s", strings.Join(append(stack, step.Include), " -> ")))
+			continue
+		}
+
+		fragment, err := loadFragment(library, step.Include)
+
+		if err != nil {
+			stepErr(err)
+			continue
+		}
+
+		fragmentParams, paramsErrs := fragmentParameters(step.Include, fragment, replaceFragmentParams(step.With, params))
+
+		if len(paramsErrs) > 0 {
+			for _, err := range paramsErrs {
+				stepErr(err)
+			}
+			continue
+		}
+
+		fragmentSteps, fragmentErrs := resolveIncludes(fmt.Sprintf("%s%d: fragment %s#", prefix, i, step.Include), fragment.Steps, library, append(stack, step.Include), fragmentParams)
+
+		errs = append(errs, fragmentErrs...)
+
+		if !hasControlFields(&step) {
+			resolved = append(resolved, fragmentSteps...)
+			continue
+		}
+
+		// The condition, repetition and retries of the include apply to the fragment as a whole.
+		resolved = append(resolved, StepConfig{
+			When:         step.When,
+			Repeat:       step.Repeat,
+			Retry:        step.Retry,
+			RetryDelay:   step.RetryDelay,
+			RetryBackoff: step.RetryBackoff,
+			RetryJitter:  step.RetryJitter,
+			Steps:        fragmentSteps,
+		})
+	}
+
+	return resolved, errs
+}
+
+// loadFragment loads a fragment from the library.
+func loadFragment(library, name string) (*FragmentConfig, error) {
+	if library == "" {
+		return nil, fmt.Errorf("fragment %s not found, there is no %s directory", name, LibraryDirName)
+	}
+
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("invalid fragment name %s", name)
+	}
+
+	for _, ext := range []string{".yml", ".yaml"} {
+		path := filepath.Join(library, name+ext)
+
+		if _, err := os.Stat(path); err == nil {
+			fragment, err := LoadFragmentConfigFromFile(path)
+
+			if err != nil {
+				return nil, fmt.Errorf("fragment %s: %w", name, err)
+			}
+
+			return fragment, nil
+		}
+	}
+
+	return nil, fmt.Errorf("fragment %s not found in %s", name, library)
+}
+
+// fragmentParameters returns the parameters of a fragment, with the defaults of the missing ones.
+func fragmentParameters(name string, fragment *FragmentConfig, with map[string]string) (map[string]string, []error) {
+	params := make(map[string]string, len(fragment.Parameters))
+	errs := []error{}
+
+	for k, v := range fragment.Parameters {
+		params[k] = v
+	}
+
+	unknown := []string{}
+
+	for k, v := range with {
+		if _, ok := fragment.Parameters[k]; !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+
+		params[k] = v
+	}
+
+	sort.Strings(unknown)
+
+	for _, k := range unknown {
+		errs = append(errs, fmt.Errorf("fragment %s: unknown parameter %s", name, k))
+	}
+
+	required := []string{}
+
+	for k, v := range params {
+		if v == "" {
+			required = append(required, k)
+		}
+	}
+
+	sort.Strings(required)
+
+	for _, k := range required {
+		errs = append(errs, fmt.Errorf("fragment %s: parameter %s is required", name, k))
+	}
+
+	return params, errs
+}
+
+// hasControlFields returns true if an include step has a condition, a repetition or retries.
+func hasControlFields(step *StepConfig) bool {
+	return step.When != "" || step.Repeat != nil || step.Retry > 0 || step.RetryDelay > 0 || step.RetryBackoff != "" || step.RetryJitter
+}
+
+// replaceRegisterParams replaces the fragment parameters in the names and expressions of registers.
+func replaceRegisterParams(registers []RegisterConfig, params map[string]string) []RegisterConfig {
+	if params == nil || registers == nil {
+		return registers
+	}
+
+	result := make([]RegisterConfig, len(registers))
+
+	for i, register := range registers {
+		result[i] = RegisterConfig{
+			Name:       replaceFragmentParam(register.Name, params),
+			From:       replaceFragmentParam(register.From, params),
+			Expression: replaceFragmentParam(register.Expression, params),
+		}
+	}
+
+	return result
+}
+
+// replaceFragmentParams replaces the fragment parameters in the values of a map.
+func replaceFragmentParams(m, params map[string]string) map[string]string {
+	if params == nil || m == nil {
+		return m
+	}
+
+	result := make(map[string]string, len(m))
+
+	for k, v := range m {
+		result[k] = replaceFragmentParam(v, params)
+	}
+
+	return result
+}
+
+// replaceFragmentParam replaces the fragment parameters in a value. Unknown placeholders are kept.
+func replaceFragmentParam(value string, params map[string]string) string {
+	if params == nil {
+		return value
+	}
+
+	return fragmentParamRegexp.ReplaceAllStringFunc(value, func(placeholder string) string {
+		if param, ok := params[placeholder[2:len(placeholder)-1]]; ok {
+			return param
+		}
+
+		return placeholder
+	})
+}
@@ -0,0 +1,234 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/config"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles writes the given files in a temporary directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	}
+
+	return dir
+}
+
+// TestResolveIncludes tests that fragments are expanded with their parameters.
+func TestResolveIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"library/setup.yml": `
+parameters:
+  userAgent: hidra
+  token: ""
+steps:
+  - plugin: http
+    action: setUserAgent
+    parameters:
+      user-agent: ${userAgent}
+  - include: auth
+    with:
+      value: Bearer ${token}
+`,
+		"library/auth.yml": `
+parameters:
+  value: ""
+steps:
+  - plugin: http
+    action: addHTTPHeader
+    parameters:
+      key: Authorization
+      value: ${value}
+`,
+		"samples/web/sample.yml": `
+description: sample
+steps:
+  - include: setup
+    with:
+      token: abc
+  - action: request
+    parameters:
+      url: https://example.com/${notAParam}
+`,
+	})
+
+	// Without samples root, the library is only searched next to the sample directory.
+	_, err := config.LoadSampleConfigFromFile(filepath.Join(dir, "samples/web/sample.yml"))
+	require.Error(t, err)
+
+	config.SamplesPath = filepath.Join(dir, "samples")
+	defer func() { config.SamplesPath = "" }()
+
+	sample, err := config.LoadSampleConfigFromFile(filepath.Join(dir, "samples/web/sample.yml"))
+	require.NoError(t, err)
+	require.NoError(t, sample.Verify())
+
+	require.Equal(t, 3, len(sample.Steps))
+	require.Equal(t, "hidra", sample.Steps[0].Parameters["user-agent"])
+	require.Equal(t, "Bearer abc", sample.Steps[1].Parameters["value"])
+	require.Equal(t, "https://example.com/${notAParam}", sample.Steps[2].Parameters["url"])
+}
+
+// TestLibraryPathExporterAndVerify tests that the exporter finds the same library as hidra verify.
+func TestLibraryPathExporterAndVerify(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"samples/library/ping.yml": `
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: https://example.com
+`,
+		"samples/web/sample.yml": `
+description: sample
+steps:
+  - include: ping
+`,
+	})
+
+	path := filepath.Join(dir, "samples/web/sample.yml")
+
+	// hidra verify without flags
+	verified, err := config.LoadSampleConfigFromFile(path)
+	require.NoError(t, err)
+	require.NoError(t, verified.Verify())
+
+	exporterConf, err := config.LoadExporterConfig([]byte("samples_path: " + filepath.Join(dir, "samples")))
+	require.NoError(t, err)
+
+	exporterConf.SetSamplesPaths()
+	defer (&config.ExporterConfig{}).SetSamplesPaths()
+
+	loaded, err := config.LoadSampleConfigFromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, verified.Steps, loaded.Steps)
+}
+
+// TestResolveIncludesControlFields tests that the condition and retries of an include apply to the
+// whole fragment, and that the fragment parameters are replaced in the registers and conditions.
+func TestResolveIncludesControlFields(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"library/login.yml": `
+parameters:
+  variable: token
+  path: $.token
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: https://example.com/login
+    register:
+      - name: ${variable}
+        from: jsonpath
+        expression: ${path}
+    repeat:
+      until: '{{ ne .Variables.${variable} "" }}'
+`,
+		"sample.yml": `
+description: sample
+steps:
+  - include: login
+    with:
+      variable: session
+    when: '{{ eq .Env.LOGIN "true" }}'
+    retry: 2
+    retryDelay: 5s
+  - include: login
+`,
+	})
+
+	sample, err := config.LoadSampleConfigFromFile(filepath.Join(dir, "sample.yml"))
+	require.NoError(t, err)
+	require.NoError(t, sample.Verify())
+
+	require.Equal(t, 2, len(sample.Steps))
+
+	group := sample.Steps[0]
+	require.Equal(t, `{{ eq .Env.LOGIN "true" }}`, group.When)
+	require.Equal(t, 2, group.Retry)
+	require.Equal(t, 5*time.Second, group.RetryDelay)
+	require.Equal(t, 1, len(group.Steps))
+
+	step := group.Steps[0]
+	require.Equal(t, "session", step.Register[0].Name)
+	require.Equal(t, "$.token", step.Register[0].Expression)
+	require.Equal(t, `{{ ne .Variables.session "" }}`, step.Repeat.Until)
+
+	require.Equal(t, "request", sample.Steps[1].Action)
+	require.Equal(t, "token", sample.Steps[1].Register[0].Name)
+
+	dir = writeFiles(t, map[string]string{
+		"library/login.yml": `
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: https://example.com/login
+`,
+		"sample.yml": `
+description: sample
+steps:
+  - include: login
+    register:
+      - name: token
+        from: output
+  - include: login
+    timeout: 5s
+`,
+	})
+
+	_, err = config.LoadSampleConfigFromFile(filepath.Join(dir, "sample.yml"))
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "#0: include can't be used with register"), err.Error())
+	require.True(t, strings.Contains(err.Error(), "#1: include can't be used with register"), err.Error())
+}
+
+// TestResolveIncludesErrors tests that missing fragments, missing parameters and cycles are reported.
+func TestResolveIncludesErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"library/a.yml": `
+steps:
+  - include: b
+`,
+		"library/b.yml": `
+steps:
+  - include: a
+`,
+		"library/c.yml": `
+parameters:
+  required: ""
+steps: []
+`,
+		"samples/sample.yml": `
+description: sample
+steps:
+  - include: a
+  - include: missing
+  - include: c
+    with:
+      unknown: value
+`,
+	})
+
+	_, err := config.LoadSampleConfigFromFile(filepath.Join(dir, "samples/sample.yml"))
+	require.Error(t, err)
+
+	for _, expected := range []string{
+		"include cycle a -> b -> a",
+		"#1: fragment missing not found",
+		"#2: fragment c: unknown parameter unknown",
+		"#2: fragment c: parameter required is required",
+	} {
+		require.True(t, strings.Contains(err.Error(), expected), "expected %q in %q", expected, err.Error())
+	}
+}
@@ -1,13 +1,29 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+	"github.com/hidracloud/hidra/v3/internal/utils"
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	// SamplesPath is the root directory of the samples. Defaults files are searched up to it.
+	SamplesPath = ""
+)
+
+const (
+	// RetryBackoffConstant waits the same delay between retries.
+	RetryBackoffConstant = "constant"
+	// RetryBackoffExponential doubles the delay after every retry, up to a minute.
+	RetryBackoffExponential = "exponential"
+)
+
 // SampleConfig is the sample configuration.
 type SampleConfig struct {
 	// Name is the sample name.
@@ -36,8 +52,56 @@ type SampleConfig struct {
 
 	// Variables is the variables to scrape the sample
 	Variables []map[string]string `yaml:"variables,omitempty"`
+
+	// Hooks is the steps run at some points of the sample run.
+	Hooks HooksConfig `yaml:"hooks,omitempty"`
+}
+
+// HooksConfig is the steps run at some points of a sample run, besides the hooks of the plugins.
+type HooksConfig struct {
+	// OnStart runs before the first step.
+	OnStart []StepConfig `yaml:"onStart,omitempty"`
+	// BeforeEach runs before every step.
+	BeforeEach []StepConfig `yaml:"beforeEach,omitempty"`
+	// AfterEach runs after every step, even if the step failed.
+	AfterEach []StepConfig `yaml:"afterEach,omitempty"`
+	// OnSuccess runs after the last step if no step failed.
+	OnSuccess []StepConfig `yaml:"onSuccess,omitempty"`
+}
+
+// Get returns the steps of a hook.
+func (h *HooksConfig) Get(hook string) []StepConfig {
+	switch hook {
+	case plugins.HookOnStart:
+		return h.OnStart
+	case plugins.HookBeforeEach:
+		return h.BeforeEach
+	case plugins.HookAfterEach:
+		return h.AfterEach
+	case plugins.HookOnSuccess:
+		return h.OnSuccess
+	}
+
+	return nil
+}
+
+// Set replaces the steps of a hook.
+func (h *HooksConfig) Set(hook string, steps []StepConfig) {
+	switch hook {
+	case plugins.HookOnStart:
+		h.OnStart = steps
+	case plugins.HookBeforeEach:
+		h.BeforeEach = steps
+	case plugins.HookAfterEach:
+		h.AfterEach = steps
+	case plugins.HookOnSuccess:
+		h.OnSuccess = steps
+	}
 }
 
+// SampleHooks are the hooks that can be set in the samples.
+var SampleHooks = []string{plugins.HookOnStart, plugins.HookBeforeEach, plugins.HookAfterEach, plugins.HookOnSuccess}
+
 // StepConfig is the step configuration.
 type StepConfig struct {
 	// Plugin is the plugin to scrape the sample. If not value given, the latest used plugin will be used.
@@ -52,14 +116,70 @@ type StepConfig struct {
 	IgnoreOnError bool `yaml:"ignoreOnError,omitempty" default:"false"`
 	// Timeout is the timeout to run this step.
 	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Register saves values extracted from the step output as variables for the next steps.
+	Register []RegisterConfig `yaml:"register,omitempty"`
+	// When is a template expression. If it doesn't evaluate to true, the step is skipped.
+	When string `yaml:"when,omitempty"`
+	// Repeat runs the step several times, or until a condition holds.
+	Repeat *RepeatConfig `yaml:"repeat,omitempty"`
+	// Retry is the number of times the step is retried when it fails.
+	Retry int `yaml:"retry,omitempty" default:"0"`
+	// RetryDelay is the time to wait before the first retry. Defaults to 1s.
+	RetryDelay time.Duration `yaml:"retryDelay,omitempty"`
+	// RetryBackoff is the backoff strategy between retries: constant or exponential.
+	RetryBackoff string `yaml:"retryBackoff,omitempty"`
+	// RetryJitter randomizes the delay between retries.
+	RetryJitter bool `yaml:"retryJitter,omitempty"`
+	// Parallel runs its child steps concurrently, each one with its own copy of the plugins state.
+	Parallel []StepConfig `yaml:"parallel,omitempty"`
+	// Steps runs its child steps in order. It's used to group steps inside a parallel block.
+	Steps []StepConfig `yaml:"steps,omitempty"`
+	// Include is replaced by the steps of the named fragment of the library when the sample is loaded.
+	Include string `yaml:"include,omitempty"`
+	// With is the parameters of the included fragment.
+	With map[string]string `yaml:"with,omitempty"`
+}
+
+// IsGroup returns true if the step is a group of steps instead of a plugin action.
+func (s *StepConfig) IsGroup() bool {
+	return len(s.Parallel) > 0 || len(s.Steps) > 0
+}
+
+// RepeatConfig is the configuration to run a step several times.
+type RepeatConfig struct {
+	// Until is a template expression. The step is repeated until it evaluates to true.
+	Until string `yaml:"until,omitempty"`
+	// Times is the max number of iterations. Defaults to 10 when until is set.
+	Times int `yaml:"times,omitempty"`
+	// Interval is the time to wait between iterations.
+	Interval time.Duration `yaml:"interval,omitempty"`
 }
 
-// LoadSampleConfig loads from byte array.
+// RegisterConfig is the configuration to save a value from a step output into a variable.
+type RegisterConfig struct {
+	// Name is the name of the variable, available as {{ .Variables.name }}.
+	Name string `yaml:"name,omitempty"`
+	// From is the extractor used: output, regex, jsonpath, header or element.
+	From string `yaml:"from,omitempty"`
+	// Expression is the expression given to the extractor.
+	Expression string `yaml:"expression,omitempty"`
+}
+
+// LoadSampleConfig loads a sample from yaml.
 func LoadSampleConfig(data []byte) (*SampleConfig, error) {
+	return loadSampleConfig(data)
+}
+
+// loadSampleConfig loads a sample from several yaml documents. Each document is merged on top of the
+// previous ones: maps are merged and the other fields are overridden.
+func loadSampleConfig(layers ...[]byte) (*SampleConfig, error) {
 	var config SampleConfig
-	err := yaml.Unmarshal(data, &config)
-	if err != nil {
-		return nil, err
+
+	for _, data := range layers {
+		err := yaml.Unmarshal(data, &config)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if config.Timeout == 0 {
@@ -85,13 +205,76 @@ func LoadSampleConfig(data []byte) (*SampleConfig, error) {
 	return &config, nil
 }
 
-// LoadSampleConfigFromFile loads from file.
+// sampleDirs returns the directories of a sample, from its own directory up to SamplesPath. Only the
+// sample directory is returned if SamplesPath is empty or doesn't contain the sample.
+func sampleDirs(path string) []string {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+
+	dirs := []string{dir}
+
+	if SamplesPath == "" {
+		return dirs
+	}
+
+	root, err := filepath.Abs(SamplesPath)
+	if err != nil {
+		return dirs
+	}
+
+	if rel, err := filepath.Rel(root, dir); err != nil || !filepath.IsLocal(rel) {
+		return dirs
+	}
+
+	for dir != root {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+
+	return dirs
+}
+
+// SampleDefaultsFiles returns the defaults files applied to a sample, from the outermost directory to
+// the sample directory. Directories are searched up to SamplesPath, or only the sample directory if
+// the sample isn't inside it.
+func SampleDefaultsFiles(path string) []string {
+	files := []string{}
+
+	for _, dir := range sampleDirs(path) {
+		for _, name := range utils.SampleDefaultsFileNames {
+			defaultsPath := filepath.Join(dir, name)
+
+			if _, err := os.Stat(defaultsPath); err == nil {
+				files = append([]string{defaultsPath}, files...)
+				break
+			}
+		}
+	}
+
+	return files
+}
+
+// LoadSampleConfigFromFile loads from file, merged on top of the defaults of its directories.
 func LoadSampleConfigFromFile(path string) (*SampleConfig, error) {
+	layers := [][]byte{}
+
+	for _, defaultsPath := range SampleDefaultsFiles(path) {
+		data, err := os.ReadFile(defaultsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, data)
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	cnf, err := LoadSampleConfig(data)
+
+	cnf, err := loadSampleConfig(append(layers, data)...)
 
 	if err != nil {
 		return nil, err
@@ -99,24 +282,138 @@ func LoadSampleConfigFromFile(path string) (*SampleConfig, error) {
 
 	cnf.Path = path
 
+	err = cnf.ResolveIncludes(FindLibraryPath(path))
+
+	if err != nil {
+		return nil, err
+	}
+
 	return cnf, nil
 }
 
-// Verify verifies the sample configuration.
+// Verify verifies the sample configuration against the registered plugins.
+// It returns all problems found, joined in a single error.
 func (c *SampleConfig) Verify() error {
+	errs := []error{}
+
 	if c.Description == "" {
-		return fmt.Errorf("description is required")
+		errs = append(errs, fmt.Errorf("%s: description is required", c.Path))
+	}
+
+	errs = append(errs, verifySteps(c.Path+"#", c.Steps, "")...)
+
+	for _, hook := range SampleHooks {
+		errs = append(errs, verifySteps(fmt.Sprintf("%s#hooks.%s.", c.Path, hook), c.Hooks.Get(hook), "")...)
 	}
 
-	for _, step := range c.Steps {
+	return errors.Join(errs...)
+}
+
+// verifySteps checks a list of steps. Prefix identifies the list in the errors.
+func verifySteps(prefix string, steps []StepConfig, lastPlugin string) []error {
+	errs := []error{}
+
+	for i, step := range steps {
+		stepErr := func(err error) {
+			errs = append(errs, fmt.Errorf("%s%d: %w", prefix, i, err))
+		}
+
+		if err := utils.ValidateTemplate(step.When); err != nil {
+			stepErr(fmt.Errorf("invalid when: %w", err))
+		}
+
+		if step.Repeat != nil {
+			if err := utils.ValidateTemplate(step.Repeat.Until); err != nil {
+				stepErr(fmt.Errorf("invalid repeat until: %w", err))
+			}
+
+			if step.Repeat.Until == "" && step.Repeat.Times <= 0 {
+				stepErr(fmt.Errorf("repeat requires until or times"))
+			}
+		}
+
+		if step.Retry < 0 {
+			stepErr(fmt.Errorf("retry must be positive"))
+		}
+
+		if step.RetryBackoff != "" && step.RetryBackoff != RetryBackoffConstant && step.RetryBackoff != RetryBackoffExponential {
+			stepErr(fmt.Errorf("invalid retryBackoff %s, allowed values are %s, %s", step.RetryBackoff, RetryBackoffConstant, RetryBackoffExponential))
+		}
+
+		if step.Include != "" {
+			stepErr(fmt.Errorf("fragment %s was not resolved", step.Include))
+			continue
+		}
+
+		if step.IsGroup() {
+			if step.Plugin != "" || step.Action != "" {
+				stepErr(fmt.Errorf("a group of steps can't have plugin or action"))
+			}
+
+			if len(step.Parallel) > 0 && len(step.Steps) > 0 {
+				stepErr(fmt.Errorf("parallel and steps can't be used in the same step"))
+			}
+
+			if len(step.Register) > 0 {
+				stepErr(fmt.Errorf("a group of steps can't register variables"))
+			}
+
+			errs = append(errs, verifySteps(fmt.Sprintf("%s%d.", prefix, i), step.Parallel, lastPlugin)...)
+			errs = append(errs, verifySteps(fmt.Sprintf("%s%d.", prefix, i), step.Steps, lastPlugin)...)
+			continue
+		}
+
 		if step.Action == "" {
-			return fmt.Errorf("action is required")
+			stepErr(fmt.Errorf("action is required"))
 		}
 
 		if step.Parameters == nil {
-			return fmt.Errorf("parameters is required")
+			stepErr(fmt.Errorf("parameters is required"))
+		}
+
+		if step.Plugin == "" {
+			step.Plugin = lastPlugin
+		}
+
+		if step.Plugin == "" {
+			stepErr(fmt.Errorf("plugin is required"))
+			continue
+		}
+
+		lastPlugin = step.Plugin
+
+		plugin := plugins.GetPlugin(step.Plugin)
+
+		if plugin == nil {
+			stepErr(fmt.Errorf("plugin %s not found", step.Plugin))
+			continue
+		}
+
+		if step.Action == "" {
+			continue
+		}
+
+		stepDefinition, ok := plugin.GetSteps()[step.Action]
+
+		if !ok {
+			stepErr(fmt.Errorf("action %s not found in plugin %s", step.Action, step.Plugin))
+			continue
+		}
+
+		for _, err := range stepDefinition.Validate(step.Parameters, true) {
+			stepErr(err)
+		}
+
+		for _, register := range step.Register {
+			if register.Name == "" {
+				stepErr(fmt.Errorf("register name is required"))
+			}
+
+			if plugins.GetExtractor(register.From) == nil {
+				stepErr(fmt.Errorf("register %s: extractor %s not found", register.Name, register.From))
+			}
 		}
 	}
 
-	return nil
+	return errs
 }
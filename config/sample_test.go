@@ -0,0 +1,114 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/config"
+	_ "github.com/hidracloud/hidra/v3/internal/plugins/all"
+	"github.com/hidracloud/hidra/v3/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVerifySampleConfig tests that every problem of a sample is reported.
+func TestVerifySampleConfig(t *testing.T) {
+	data := []byte(`
+description: "Sample with typos"
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: https://google.com/
+  - action: statusCodeShouldBe
+    parameters:
+      statusCode: "2OO"
+  - action: statusCodeShouldBe
+    parameters:
+      statusCode: "{{ .Variables.code }}"
+      status: 200
+  - plugin: unknown
+    action: request
+    parameters: {}
+  - plugin: http
+    action: notFound
+    parameters: {}
+`)
+	sample, err := config.LoadSampleConfig(data)
+	require.NoError(t, err)
+
+	sample.Path = "sample.yml"
+
+	err = sample.Verify()
+	require.Error(t, err)
+
+	for _, expected := range []string{
+		`sample.yml#1: invalid int value "2OO" for argument statusCode`,
+		"sample.yml#2: unknown argument status for action statusCodeShouldBe",
+		"sample.yml#3: plugin unknown not found",
+		"sample.yml#4: action notFound not found in plugin http",
+	} {
+		require.True(t, strings.Contains(err.Error(), expected), "expected %q in %q", expected, err.Error())
+	}
+
+	require.Equal(t, 4, len(strings.Split(err.Error(), "\n")))
+}
+
+// TestSampleDefaults tests that the defaults of the sample directories are merged into the sample.
+func TestSampleDefaults(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"samples/_defaults.yml": `
+interval: 30s
+timeout: 5s
+tags:
+  owner: platform
+  env: prod
+`,
+		"samples/team/_defaults.yml": `
+retry: 2
+tags:
+  owner: team
+`,
+		"samples/team/sample.yml": `
+description: sample
+timeout: 20s
+tags:
+  service: api
+steps: []
+`,
+	})
+
+	config.SamplesPath = filepath.Join(dir, "samples")
+	defer func() { config.SamplesPath = "" }()
+
+	sample, err := config.LoadSampleConfigFromFile(filepath.Join(dir, "samples/team/sample.yml"))
+	require.NoError(t, err)
+
+	require.Equal(t, 30*time.Second, sample.Interval)
+	require.Equal(t, 20*time.Second, sample.Timeout)
+	require.Equal(t, 2, sample.Retry)
+	require.Equal(t, map[string]string{"owner": "team", "env": "prod", "service": "api"}, sample.Tags)
+
+	// Defaults outside of the samples root are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "_defaults.yml"), []byte("retry: 5\ninterval: 1s\n"), 0o644))
+
+	sample, err = config.LoadSampleConfigFromFile(filepath.Join(dir, "samples/team/sample.yml"))
+	require.NoError(t, err)
+	require.Equal(t, 2, sample.Retry)
+	require.Equal(t, 30*time.Second, sample.Interval)
+
+	// Without samples root, only the defaults of the sample directory are applied.
+	config.SamplesPath = ""
+
+	sample, err = config.LoadSampleConfigFromFile(filepath.Join(dir, "samples/team/sample.yml"))
+	require.NoError(t, err)
+	require.Equal(t, 2, sample.Retry)
+	require.Equal(t, 60*time.Second, sample.Interval)
+	require.Equal(t, map[string]string{"owner": "team", "service": "api"}, sample.Tags)
+
+	samples, err := utils.AutoDiscoverYML(filepath.Join(dir, "samples"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "samples") + "/team/sample.yml"}, samples)
+}
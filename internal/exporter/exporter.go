@@ -94,6 +94,7 @@ func Initialize(config *config.ExporterConfig) {
 	err := http.ListenAndServe(config.HTTPServerConfig.ListenAddress, myMux)
 
 	if err != nil {
+		runShutdownHooks()
 		panic(err)
 	}
 }
@@ -26,6 +26,12 @@ var (
 	// penaltiesSamples is the penalties
 	penaltiesSamples = make(map[string]time.Duration)
 
+	// shutdownHooks are the functions run before the exporter exits
+	shutdownHooks []func()
+
+	// shutdownHooksMutex is the mutex to protect the shutdown hooks
+	shutdownHooksMutex sync.Mutex
+
 	// enqueueSamplesInProgress  is the enqueue samples in progress
 	enqueueSamplesInProgress = false
 
@@ -201,11 +207,11 @@ func signalHandler(signal os.Signal, cnf *config.ExporterConfig) {
 		log.Debug("Received SIGHUP, refreshing samples...")
 		refreshSamples(cnf)
 	case syscall.SIGINT:
-		os.Exit(0)
+		shutdown(0)
 	case syscall.SIGTERM:
-		os.Exit(0)
+		shutdown(0)
 	case syscall.SIGQUIT:
-		os.Exit(0)
+		shutdown(0)
 	case syscall.SIGUSR1:
 	case syscall.SIGURG:
 	case syscall.SIGCHLD:
@@ -214,6 +220,30 @@ func signalHandler(signal os.Signal, cnf *config.ExporterConfig) {
 	}
 }
 
+// OnShutdown registers a function to run before the exporter exits, like stopping the external plugins.
+func OnShutdown(fn func()) {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+
+	shutdownHooks = append(shutdownHooks, fn)
+}
+
+// runShutdownHooks runs the functions registered with OnShutdown.
+func runShutdownHooks() {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+
+	for _, fn := range shutdownHooks {
+		fn()
+	}
+}
+
+// shutdown runs the shutdown hooks and exits with the given code.
+func shutdown(code int) {
+	runShutdownHooks()
+	os.Exit(code)
+}
+
 // listenForOSSignals listens for OS signals
 func listenForOSSignals(cnf *config.ExporterConfig) {
 	sigchnl := make(chan os.Signal, 1)
@@ -142,6 +142,9 @@ func createMetrics(metric *metrics.Metric, sample *config.SampleConfig) {
 
 // updateMetrics updates the metrics
 func updateMetrics(allMetrics []*metrics.Metric, sample *config.SampleConfig, startTime time.Time, err error) {
+	// Steps not reached in this run must not keep the values of the previous one
+	deleteStepMetrics(sample)
+
 	// Purge metrics if metric.Purge is true
 	for _, metric := range allMetrics {
 		addMetric2PurgeListIfNeeeded(metric, sample)
@@ -163,6 +166,18 @@ func updateMetrics(allMetrics []*metrics.Metric, sample *config.SampleConfig, st
 	prometheusLastUpdate.With(statusLabels).Set(float64(time.Now().Unix()))
 }
 
+// deleteStepMetrics deletes the step metrics of the sample.
+func deleteStepMetrics(sample *config.SampleConfig) {
+	prometheusMetricStoreMutex.RLock()
+	defer prometheusMetricStoreMutex.RUnlock()
+
+	for _, name := range runner.StepMetricNames {
+		if prometheusMetric, ok := prometheusMetricStore[name]; ok {
+			prometheusMetric.DeletePartialMatch(prometheus.Labels{"sample_name": sample.Name})
+		}
+	}
+}
+
 // createLabelsForStatus creates the labels for status
 func createLabelsForStatus(sample *config.SampleConfig) prometheus.Labels {
 	return createLabels(&metrics.Metric{}, sample)
@@ -190,11 +205,7 @@ func createLabels(metric *metrics.Metric, sample *config.SampleConfig) prometheu
 	}
 
 	pluginList := make(map[string]bool, 0)
-	for _, step := range sample.Steps {
-		if step.Plugin != "" {
-			pluginList[step.Plugin] = true
-		}
-	}
+	addStepsPlugins(pluginList, sample.Steps)
 
 	allPlugins := make([]string, 0)
 
@@ -210,6 +221,18 @@ func createLabels(metric *metrics.Metric, sample *config.SampleConfig) prometheu
 	return labels
 }
 
+// addStepsPlugins adds the plugins used by the steps, including the steps inside groups.
+func addStepsPlugins(pluginList map[string]bool, steps []config.StepConfig) {
+	for _, step := range steps {
+		if step.Plugin != "" {
+			pluginList[step.Plugin] = true
+		}
+
+		addStepsPlugins(pluginList, step.Parallel)
+		addStepsPlugins(pluginList, step.Steps)
+	}
+}
+
 // initializePrometheusMetrics initializes the prometheus metrics
 func initializePrometheusMetrics(metric *metrics.Metric) *prometheus.GaugeVec {
 	prometheusMetricStoreMutex.RLock()
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/hidracloud/hidra/v3/config"
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/runner"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countSeries returns the number of series of a metric.
+func countSeries(metric *prometheus.GaugeVec) int {
+	ch := make(chan prometheus.Metric, 16)
+	metric.Collect(ch)
+	close(ch)
+
+	return len(ch)
+}
+
+func TestDeleteStepMetrics(t *testing.T) {
+	sampleCommonTags = []string{"sample_name", "plugins", "description"}
+
+	sample := &config.SampleConfig{Name: "steps"}
+	other := &config.SampleConfig{Name: "other"}
+
+	names := []string{runner.StepDurationMetric, runner.StepSuccessMetric, runner.StepIterationsMetric, runner.StepRetriesMetric}
+
+	for _, name := range names {
+		for _, s := range []*config.SampleConfig{sample, other} {
+			createMetrics(&metrics.Metric{
+				Name:   name,
+				Value:  1,
+				Labels: map[string]string{"step": "0", "plugin": "http", "action": "request"},
+			}, s)
+		}
+	}
+
+	deleteStepMetrics(sample)
+
+	for _, name := range names {
+		if series := countSeries(prometheusMetricStore[name]); series != 1 {
+			t.Errorf("expected only the series of the other sample in %s, got %d", name, series)
+		}
+	}
+}
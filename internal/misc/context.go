@@ -5,12 +5,18 @@ var (
 	ContextBrowserChromedpCancel = "browser.chromedpcancel"
 	// ContextBrowserChromedpCtx is the context key for the chromedp context.
 	ContextBrowserChromedpCtx = "browser.chromedpctx"
+	// ContextBrowserProxy is the context key for the browser proxy.
+	ContextBrowserProxy = "browser.proxy"
 	// PreviousTimeouts is the context key for the timeouts.
 	ContextTimeout = "timeouts"
 	// ContextSample is the context key for the sample.
 	ContextSample = "sample"
+	// ContextSamplePath is the context key for the path of the sample file.
+	ContextSamplePath = "sample.path"
 	// ContextDNSInfo
 	ContextDNSInfo = "dns.info"
+	// ContextExternalSession is the context key for the external plugins session.
+	ContextExternalSession = "external.session"
 	// ContextFTPConnection is the context key for the FTP connection.
 	ContextFTPConnection = "ftp.connection"
 	// ContextFTPHost is the context key for the FTP host.
@@ -19,6 +25,26 @@ var (
 	ContextOutput = "output"
 	// ContextHTTPTlsInsecureSkipVerify is the context key for the TLS insecure skip verify.
 	ContextHTTPTlsInsecureSkipVerify = "http.tlsinsecureskipverify"
+	// ContextHTTPTlsCA is the context key for the TLS CA bundle file.
+	ContextHTTPTlsCA = "http.tlsca"
+	// ContextHTTPTlsClientCert is the context key for the TLS client certificate file.
+	ContextHTTPTlsClientCert = "http.tlsclientcert"
+	// ContextHTTPTlsClientKey is the context key for the TLS client key file.
+	ContextHTTPTlsClientKey = "http.tlsclientkey"
+	// ContextHTTPAuthorization is the context key for the HTTP Authorization header.
+	ContextHTTPAuthorization = "http.authorization"
+	// ContextHTTPClient is the context key for the HTTP client of the sample.
+	ContextHTTPClient = "http.client"
+	// ContextHTTPCookieJar is the context key for the HTTP cookie jar.
+	ContextHTTPCookieJar = "http.cookiejar"
+	// ContextHTTPFreshConnection is the context key for disabling the HTTP keep-alive.
+	ContextHTTPFreshConnection = "http.freshconnection"
+	// ContextHTTPProxy is the context key for the HTTP proxy.
+	ContextHTTPProxy = "http.proxy"
+	// ContextHTTPTimeout is the context key for the HTTP requests timeout.
+	ContextHTTPTimeout = "http.timeout"
+	// ContextHTTPVersion is the context key for the HTTP version.
+	ContextHTTPVersion = "http.version"
 	// ContextHTTPForceIP is the context key for the HTTP force IP.
 	ContextHTTPForceIP = "http.forceip"
 	// ContextConnectionIP is the context key for the connection IP.
@@ -31,10 +57,18 @@ var (
 	ContextHTTPMethod = "http.method"
 	// ContextHTTPURL is the context key for the HTTP URL.
 	ContextHTTPURL = "http.url"
+	// ContextHTTPRedirects is the context key for the HTTP redirect chain.
+	ContextHTTPRedirects = "http.redirects"
 	// ContextHTTPResponse is the context key for the HTTP response.
 	ContextHTTPResponse = "http.response"
 	// ContextHTTPBody is the context key for the HTTP body.
 	ContextHTTPBody = "http.body"
+	// ContextHTTPResponseBody is the context key for the size, checksums and throughput of the HTTP response body.
+	ContextHTTPResponseBody = "http.responsebody"
+	// ContextHTTPMaxBodySize is the context key for the HTTP response body size limit.
+	ContextHTTPMaxBodySize = "http.maxbodysize"
+	// ContextHTTPBodyChecksum is the context key for the hash algorithm of the HTTP response bodies.
+	ContextHTTPBodyChecksum = "http.bodychecksum"
 	// ContextAttachment is the context key for the attachment.
 	ContextAttachment = "attachment"
 	// ContextTCPConnection is the context key for the TCP connection.
@@ -50,3 +84,16 @@ var (
 	// LastError is the context key for the last error.
 	ContextLastError = "last.error"
 )
+
+// RunResources are the context keys of the connections, sessions, clients and browsers opened by a
+// sample run. They are not shared with the children of a parallel group, which open their own.
+var RunResources = []string{
+	ContextBrowserChromedpCancel,
+	ContextBrowserChromedpCtx,
+	ContextExternalSession,
+	ContextFTPConnection,
+	ContextHTTPClient,
+	ContextTCPConnection,
+	ContextTLSConnection,
+	ContextUDPConnection,
+}
@@ -202,6 +202,7 @@ func (p *DNS) Init() {
 			{
 				Name:        "for",
 				Description: "The duration to check if the domain is valid",
+				Type:        plugins.ParamTypeDuration,
 				Optional:    false,
 			},
 			{
@@ -236,9 +237,11 @@ func (p *DNS) Init() {
 				Optional:    false,
 			},
 			{
-				Name:        "type",
-				Description: "The type of the query",
-				Optional:    false,
+				Name:          "type",
+				Description:   "The type of the query",
+				Type:          plugins.ParamTypeEnum,
+				AllowedValues: []string{"a", "aaaa", "cname", "mx"},
+				Optional:      false,
 			},
 			{
 				Name:        "host",
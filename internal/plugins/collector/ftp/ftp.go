@@ -210,6 +210,7 @@ func (p *FTP) Init() {
 			{
 				Name:        "to",
 				Description: "Host to connect to",
+				Type:        plugins.ParamTypeHostPort,
 				Optional:    false,
 			},
 		},
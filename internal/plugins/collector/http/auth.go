@@ -0,0 +1,245 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+const (
+	// tokenExpiryMargin is how long before its expiry a cached token is refreshed.
+	tokenExpiryMargin = 30 * time.Second
+
+	// maxCachedTokens is the number of tokens kept in the cache. When it is full, the token expiring
+	// first is evicted.
+	maxCachedTokens = 1024
+
+	// maxTokenResponseSize is the number of bytes read from the response of a token endpoint.
+	maxTokenResponseSize = 1 << 20
+)
+
+var (
+	// tokenCache keeps the OAuth2 tokens across sample runs until they expire, see cacheToken.
+	tokenCache = make(map[string]*cachedToken)
+
+	// tokenCacheMutex guards tokenCache.
+	tokenCacheMutex sync.Mutex
+)
+
+// cachedToken is an OAuth2 access token and its expiry.
+type cachedToken struct {
+	authorization string
+	expiresAt     time.Time
+}
+
+// tokenResponse is the response of an OAuth2 token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	// Error is the error code of a failed request, like invalid_client.
+	Error string `json:"error"`
+}
+
+// basicAuth sends the following requests with basic authentication.
+func (p *HTTP) basicAuth(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	credentials := base64.StdEncoding.EncodeToString([]byte(args["username"] + ":" + args["password"]))
+	stepsgen[misc.ContextHTTPAuthorization] = "Basic " + credentials
+
+	return nil, nil
+}
+
+// bearerToken sends the following requests with a bearer token.
+func (p *HTTP) bearerToken(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	stepsgen[misc.ContextHTTPAuthorization] = "Bearer " + args["token"]
+
+	return nil, nil
+}
+
+// clearAuth sends the following requests without authentication.
+func (p *HTTP) clearAuth(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	delete(stepsgen, misc.ContextHTTPAuthorization)
+
+	return nil, nil
+}
+
+// oauth2Token gets an access token from an OAuth2 token endpoint, or from the cache, and sends the
+// following requests with it.
+func (p *HTTP) oauth2Token(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	if args["grantType"] == "password" && args["username"] == "" {
+		return nil, fmt.Errorf("the password grant needs a username")
+	}
+
+	key := tokenCacheKey(args)
+
+	tokenCacheMutex.Lock()
+	token, ok := tokenCache[key]
+	tokenCacheMutex.Unlock()
+
+	if ok && time.Now().Before(token.expiresAt) {
+		stepsgen[misc.ContextHTTPAuthorization] = token.authorization
+		return nil, nil
+	}
+
+	token, err := fetchToken(ctx, args, stepsgen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cacheToken(key, token)
+
+	stepsgen[misc.ContextHTTPAuthorization] = token.authorization
+
+	return nil, nil
+}
+
+// cacheToken adds a token to the cache, evicting the expired ones. If the cache is still full, the
+// token expiring first is evicted too.
+func cacheToken(key string, token *cachedToken) {
+	now := time.Now()
+
+	if !now.Before(token.expiresAt) {
+		return
+	}
+
+	tokenCacheMutex.Lock()
+	defer tokenCacheMutex.Unlock()
+
+	for k, cached := range tokenCache {
+		if !now.Before(cached.expiresAt) {
+			delete(tokenCache, k)
+		}
+	}
+
+	if _, ok := tokenCache[key]; !ok && len(tokenCache) >= maxCachedTokens {
+		first := ""
+
+		for k, cached := range tokenCache {
+			if first == "" || cached.expiresAt.Before(tokenCache[first].expiresAt) {
+				first = k
+			}
+		}
+
+		delete(tokenCache, first)
+	}
+
+	tokenCache[key] = token
+}
+
+// tokenCacheKey returns the cache key of the token of a request. Secrets are hashed with the rest of
+// the parameters, so a new secret gets a new token.
+func tokenCacheKey(args map[string]string) string {
+	hash := sha256.New()
+
+	for _, name := range []string{"tokenURL", "grantType", "clientID", "clientSecret", "username", "password", "scope", "audience"} {
+		fmt.Fprintf(hash, "%s=%q\n", name, args[name])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// fetchToken requests an access token to the token endpoint.
+func fetchToken(ctx context.Context, args map[string]string, stepsgen map[string]any) (*cachedToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", args["grantType"])
+
+	if args["grantType"] == "password" {
+		form.Set("username", args["username"])
+		form.Set("password", args["password"])
+	}
+
+	for param, name := range map[string]string{"scope": "scope", "audience": "audience"} {
+		if value := args[name]; value != "" {
+			form.Set(param, value)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout(stepsgen))
+	defer cancel()
+
+	if proxy := requestProxy(nil, stepsgen); proxy != "" {
+		// nolint:staticcheck
+		ctx = context.WithValue(ctx, misc.ContextHTTPProxy, proxy)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, args["tokenURL"], strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("hidra/monitoring %s", misc.Version))
+	req.SetBasicAuth(url.QueryEscape(args["clientID"]), url.QueryEscape(args["clientSecret"]))
+
+	client, err := clientFor(stepsgen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenResponseSize))
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := tokenResponse{}
+
+	// The body isn't part of the errors, as it may have secrets. Only the OAuth2 error code is.
+	if resp.StatusCode != http.StatusOK {
+		if json.Unmarshal(body, &response) == nil && response.Error != "" {
+			return nil, fmt.Errorf("token endpoint returned status code %d: %s", resp.StatusCode, response.Error)
+		}
+
+		return nil, fmt.Errorf("token endpoint returned status code %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if response.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access_token")
+	}
+
+	tokenType := response.TokenType
+
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	// Tokens without expiry are not cached.
+	expiresAt := time.Now()
+
+	if response.ExpiresIn > 0 {
+		expiresAt = expiresAt.Add(time.Duration(response.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+
+	return &cachedToken{
+		authorization: tokenType + " " + response.AccessToken,
+		expiresAt:     expiresAt,
+	}, nil
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+// bodySources are the arguments of the request step which set the body. Only one source can be given,
+// the fields and files of a multipart body are the same source.
+var bodySources = map[string]string{
+	"body":            "body",
+	"bodyFile":        "bodyFile",
+	"form":            "form",
+	"multipartFields": "multipart",
+	"multipartFiles":  "multipart",
+}
+
+// samplePath resolves a path relative to the directory of the sample.
+func samplePath(stepsgen map[string]any, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	if sample, ok := stepsgen[misc.ContextSamplePath].(string); ok && sample != "" {
+		return filepath.Join(filepath.Dir(sample), path)
+	}
+
+	return path
+}
+
+// requestBody returns the body of a request and its content type, if it can be guessed.
+func requestBody(args map[string]string, stepsgen map[string]any) ([]byte, string, error) {
+	sources := []string{}
+
+	for arg, source := range bodySources {
+		if args[arg] != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+
+	if len(sources) > 1 {
+		sort.Strings(sources)
+		return nil, "", fmt.Errorf("only one body can be given, got %s", strings.Join(sources, ", "))
+	}
+
+	switch {
+	case args["bodyFile"] != "":
+		path := samplePath(stepsgen, args["bodyFile"])
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+
+		return data, contentType, nil
+	case args["form"] != "":
+		fields, err := url.ParseQuery(args["form"])
+
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid form: %w", err)
+		}
+
+		return []byte(fields.Encode()), "application/x-www-form-urlencoded", nil
+	case args["multipartFields"] != "" || args["multipartFiles"] != "":
+		return multipartBody(args, stepsgen)
+	}
+
+	return []byte(args["body"]), "", nil
+}
+
+// multipartBody returns a multipart/form-data body with the fields and the files of the arguments.
+func multipartBody(args map[string]string, stepsgen map[string]any) ([]byte, string, error) {
+	fields, err := url.ParseQuery(args["multipartFields"])
+
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid multipart fields: %w", err)
+	}
+
+	files, err := url.ParseQuery(args["multipartFiles"])
+
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid multipart files: %w", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for _, name := range sortedKeys(fields) {
+		for _, value := range fields[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(files) {
+		for _, file := range files[name] {
+			path := samplePath(stepsgen, file)
+			data, err := os.ReadFile(path)
+
+			if err != nil {
+				return nil, "", err
+			}
+
+			contentType := mime.TypeByExtension(filepath.Ext(path))
+
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+				"name":     name,
+				"filename": filepath.Base(path),
+			}))
+			header.Set("Content-Type", contentType)
+
+			part, err := writer.CreatePart(header)
+
+			if err != nil {
+				return nil, "", err
+			}
+
+			if _, err := part.Write(data); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// sortedKeys returns the keys of the values in order, so bodies are the same across runs.
+func sortedKeys(values url.Values) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
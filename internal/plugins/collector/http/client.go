@@ -0,0 +1,208 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRequestTimeout is the timeout of a request when neither the step nor the sample set one.
+	defaultRequestTimeout = 30 * time.Second
+)
+
+// clientSettings is the configuration of the HTTP client of a sample.
+type clientSettings struct {
+	insecure        bool
+	caFile          string
+	certFile        string
+	keyFile         string
+	freshConnection bool
+	version         string
+	jar             *cookieJar
+}
+
+// sampleClient is the HTTP client of a sample run and the settings it was built with.
+type sampleClient struct {
+	settings clientSettings
+	client   *http.Client
+}
+
+// settingsFrom returns the client settings of the sample.
+func settingsFrom(stepsgen map[string]any) clientSettings {
+	settings := clientSettings{}
+
+	settings.insecure, _ = stepsgen[misc.ContextHTTPTlsInsecureSkipVerify].(bool)
+	settings.caFile, _ = stepsgen[misc.ContextHTTPTlsCA].(string)
+	settings.certFile, _ = stepsgen[misc.ContextHTTPTlsClientCert].(string)
+	settings.keyFile, _ = stepsgen[misc.ContextHTTPTlsClientKey].(string)
+	settings.freshConnection, _ = stepsgen[misc.ContextHTTPFreshConnection].(bool)
+	settings.version, _ = stepsgen[misc.ContextHTTPVersion].(string)
+	settings.jar, _ = stepsgen[misc.ContextHTTPCookieJar].(*cookieJar)
+
+	return settings
+}
+
+// clientFor returns the HTTP client of the sample. Every sample run has its own client, so connections
+// are never reused across runs or samples. The client is built again when a step changes its settings.
+func clientFor(stepsgen map[string]any) (*http.Client, error) {
+	settings := settingsFrom(stepsgen)
+
+	current, ok := stepsgen[misc.ContextHTTPClient].(*sampleClient)
+
+	if ok && current.settings == settings {
+		return current.client, nil
+	}
+
+	client, err := newHTTPClient(settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		closeClient(current.client)
+	}
+
+	stepsgen[misc.ContextHTTPClient] = &sampleClient{
+		settings: settings,
+		client:   client,
+	}
+
+	return client, nil
+}
+
+// closeIdleConnections closes the idle connections of the client of the sample.
+func closeIdleConnections(stepsgen map[string]any) {
+	if current, ok := stepsgen[misc.ContextHTTPClient].(*sampleClient); ok {
+		closeClient(current.client)
+	}
+}
+
+// closeClient closes the idle connections of a client, and the sockets of its transport if it has.
+func closeClient(client *http.Client) {
+	client.CloseIdleConnections()
+
+	if closer, ok := client.Transport.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Debugf("Error closing the HTTP transport: %s", err)
+		}
+	}
+}
+
+// forcedIP is the IP dialed for a host and port, instead of the resolved ones.
+type forcedIP struct {
+	addr string
+	ip   string
+}
+
+// withForcedIP returns a context dialing the host and port of a URL to the given IP. Other hosts, like
+// the ones of the redirects, are resolved as usual.
+func withForcedIP(ctx context.Context, u *url.URL, ip string) context.Context {
+	port := u.Port()
+
+	if port == "" {
+		port = "80"
+
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	// nolint:staticcheck
+	return context.WithValue(ctx, misc.ContextHTTPForceIP, &forcedIP{
+		addr: net.JoinHostPort(u.Hostname(), port),
+		ip:   ip,
+	})
+}
+
+// dialAddress returns the address dialed for a host and port, the forced IP if there is one for them.
+func dialAddress(ctx context.Context, addr string) string {
+	forced, ok := ctx.Value(misc.ContextHTTPForceIP).(*forcedIP)
+
+	if !ok || !strings.EqualFold(forced.addr, addr) {
+		return addr
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return addr
+	}
+
+	return net.JoinHostPort(forced.ip, port)
+}
+
+// requestTimeout returns the timeout of a request, set by the setTimeout step or else by the sample.
+func requestTimeout(stepsgen map[string]any) time.Duration {
+	if timeout, ok := stepsgen[misc.ContextHTTPTimeout].(time.Duration); ok {
+		return timeout
+	}
+
+	if timeout, ok := stepsgen[misc.ContextTimeout].(time.Duration); ok && timeout > 0 {
+		return timeout
+	}
+
+	return defaultRequestTimeout
+}
+
+// newHTTPClient returns a client using the given settings.
+func newHTTPClient(settings clientSettings) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(settings.insecure, settings.caFile, settings.certFile, settings.keyFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     10 * time.Second,
+		DisableKeepAlives:   settings.freshConnection,
+		TLSClientConfig:     tlsConfig,
+		Proxy:               proxyFromContext,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := &net.Dialer{}
+
+			// Behind a proxy, only the proxy is dialed.
+			proxy, _ := ctx.Value(misc.ContextHTTPProxy).(string)
+
+			if proxy == "" {
+				addr = dialAddress(ctx, addr)
+			}
+
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+
+	switch settings.version {
+	case "1.1":
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case "2":
+		transport.ForceAttemptHTTP2 = true
+	}
+
+	// The client has no timeout, the context of each request has the one of requestTimeout.
+	client := &http.Client{
+		CheckRedirect: checkRedirect,
+		Transport:     transport,
+	}
+
+	if settings.version == "3" {
+		client.Transport = newHTTP3Transport(tlsConfig)
+	}
+
+	if settings.jar != nil {
+		client.Jar = settings.jar
+	}
+
+	return client, nil
+}
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieJar is the cookie jar of a sample run. It can be cleared without replacing the client.
+type cookieJar struct {
+	mutex sync.Mutex
+	jar   *cookiejar.Jar
+}
+
+// newCookieJar returns an empty cookie jar.
+func newCookieJar() (*cookieJar, error) {
+	c := &cookieJar{}
+
+	return c, c.clear()
+}
+
+// clear removes all the cookies.
+func (c *cookieJar) clear() error {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.jar = jar
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// SetCookies implements the http.CookieJar interface.
+func (c *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	c.mutex.Lock()
+	jar := c.jar
+	c.mutex.Unlock()
+
+	jar.SetCookies(u, cookies)
+}
+
+// Cookies implements the http.CookieJar interface.
+func (c *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	c.mutex.Lock()
+	jar := c.jar
+	c.mutex.Unlock()
+
+	return jar.Cookies(u)
+}
+
+// cookieJarFor returns the cookie jar of the sample, creating it if cookies are not enabled yet.
+func cookieJarFor(stepsgen map[string]any) (*cookieJar, error) {
+	if jar, ok := stepsgen[misc.ContextHTTPCookieJar].(*cookieJar); ok {
+		return jar, nil
+	}
+
+	jar, err := newCookieJar()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stepsgen[misc.ContextHTTPCookieJar] = jar
+
+	return jar, nil
+}
+
+// cookieURL returns the URL a cookie step applies to, the last requested one by default.
+func cookieURL(args map[string]string, stepsgen map[string]any) (*url.URL, error) {
+	rawURL := args["url"]
+
+	if rawURL == "" {
+		rawURL, _ = stepsgen[misc.ContextHTTPURL].(string)
+	}
+
+	if rawURL == "" {
+		return nil, fmt.Errorf("no URL given and no previous request")
+	}
+
+	return url.Parse(rawURL)
+}
+
+// enableCookies keeps the cookies set by the responses and sends them in the following requests.
+func (p *HTTP) enableCookies(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	_, err := cookieJarFor(stepsgen)
+
+	return nil, err
+}
+
+// setCookie adds a cookie to the jar.
+func (p *HTTP) setCookie(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	u, err := cookieURL(args, stepsgen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	jar, err := cookieJarFor(stepsgen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	jar.SetCookies(u, []*http.Cookie{
+		{
+			Name:  args["name"],
+			Value: args["value"],
+			Path:  args["path"],
+		},
+	})
+
+	return nil, nil
+}
+
+// clearCookies removes all the cookies of the jar.
+func (p *HTTP) clearCookies(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	jar, ok := stepsgen[misc.ContextHTTPCookieJar].(*cookieJar)
+
+	if !ok {
+		return nil, nil
+	}
+
+	return nil, jar.clear()
+}
+
+// cookieShouldBeSent checks if the jar has a cookie for a URL, so it is sent in the next request.
+func (p *HTTP) cookieShouldBeSent(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	jar, ok := stepsgen[misc.ContextHTTPCookieJar].(*cookieJar)
+
+	if !ok {
+		return nil, fmt.Errorf("cookies are not enabled")
+	}
+
+	u, err := cookieURL(args, stepsgen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cookie := range jar.Cookies(u) {
+		if cookie.Name != args["name"] {
+			continue
+		}
+
+		if value, ok := args["value"]; ok && cookie.Value != value {
+			return nil, fmt.Errorf("expected cookie %s to be %s, got %s", args["name"], value, cookie.Value)
+		}
+
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("cookie %s not found for %s", args["name"], u)
+}
+
+// responseCookies returns the cookies set by the redirects followed by the last request and by its
+// final response, in the order they were received.
+func responseCookies(resp *http.Response, stepsgen map[string]any) []*http.Cookie {
+	cookies := []*http.Cookie{}
+
+	if chain, ok := stepsgen[misc.ContextHTTPRedirects].(*redirectChain); ok {
+		for _, hop := range chain.hops {
+			cookies = append(cookies, hop.Cookies...)
+		}
+	}
+
+	return append(cookies, resp.Cookies()...)
+}
+
+// cookieShouldBeSet checks a cookie set by the response or by one of the redirects leading to it,
+// with its flags. If the cookie is set several times, the last one is checked.
+func (p *HTTP) cookieShouldBeSet(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	resp, ok := stepsgen[misc.ContextHTTPResponse].(*http.Response)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	var cookie *http.Cookie
+
+	for _, c := range responseCookies(resp, stepsgen) {
+		if c.Name == args["name"] {
+			cookie = c
+		}
+	}
+
+	if cookie == nil {
+		return nil, fmt.Errorf("cookie %s not set by the response", args["name"])
+	}
+
+	if value, ok := args["value"]; ok && cookie.Value != value {
+		return nil, fmt.Errorf("expected cookie %s to be %s, got %s", args["name"], value, cookie.Value)
+	}
+
+	for flag, actual := range map[string]bool{"secure": cookie.Secure, "httpOnly": cookie.HttpOnly} {
+		value, ok := args[flag]
+
+		if !ok {
+			continue
+		}
+
+		expected, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if expected != actual {
+			return nil, fmt.Errorf("expected %s flag of cookie %s to be %t", flag, args["name"], expected)
+		}
+	}
+
+	if sameSite, ok := args["sameSite"]; ok && !strings.EqualFold(sameSite, sameSiteName(cookie.SameSite)) {
+		return nil, fmt.Errorf("expected SameSite of cookie %s to be %s, got %s", args["name"], sameSite, sameSiteName(cookie.SameSite))
+	}
+
+	return nil, nil
+}
+
+// sameSiteName returns the name of a SameSite mode, as written in the Set-Cookie header.
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+
+	return ""
+}
@@ -0,0 +1,234 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+// defaultMaxBodySize is the number of bytes of a response body kept when the sample doesn't set it.
+const defaultMaxBodySize = 10 << 20
+
+// hashAlgorithms are the algorithms of the response body checksums.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New, // nolint:gosec
+	"sha256": sha256.New,
+}
+
+// responseBody is the summary of a response body, which is read whole even when only part of it is kept.
+type responseBody struct {
+	data       []byte
+	size       int64
+	truncated  bool
+	algorithm  string
+	checksum   string
+	throughput float64
+}
+
+// readBody reads a response body, keeping at most maxSize bytes. The rest is discarded as it arrives,
+// so big downloads don't end up in memory. A maxSize of 0 keeps the whole body. If algorithm is not
+// empty, the whole body is hashed with it while it is read.
+func readBody(r io.Reader, maxSize int64, algorithm string) ([]byte, *responseBody, error) {
+	tee := r
+
+	var h hash.Hash
+
+	if newHash, ok := hashAlgorithms[algorithm]; ok {
+		h = newHash()
+		tee = io.TeeReader(r, h)
+	}
+
+	var buf bytes.Buffer
+
+	var kept int64
+	var err error
+
+	if maxSize > 0 {
+		kept, err = io.CopyN(&buf, tee, maxSize)
+
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	} else {
+		kept, err = io.Copy(&buf, tee)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	discarded, err := io.Copy(io.Discard, tee)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := &responseBody{
+		data:      buf.Bytes(),
+		size:      kept + discarded,
+		truncated: discarded > 0,
+	}
+
+	if h != nil {
+		body.algorithm = algorithm
+		body.checksum = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return body.data, body, nil
+}
+
+// checksumOf returns the checksum of the whole body. Bodies kept whole are hashed on demand, the
+// truncated ones only have the checksum of the algorithm set before the request.
+func (b *responseBody) checksumOf(algorithm string) (string, error) {
+	if b.algorithm == algorithm {
+		return b.checksum, nil
+	}
+
+	if b.truncated {
+		return "", fmt.Errorf("the body was truncated, set the %s checksum with setBodyChecksum before the request", algorithm)
+	}
+
+	h := hashAlgorithms[algorithm]()
+	h.Write(b.data)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// maxBodySize returns the number of bytes of the response bodies kept by the sample, 0 for all of them.
+func maxBodySize(stepsgen map[string]any) int64 {
+	if size, ok := stepsgen[misc.ContextHTTPMaxBodySize].(int64); ok {
+		return size
+	}
+
+	return defaultMaxBodySize
+}
+
+// parseSize parses a size in bytes, like 1024, 10MB or 1GiB.
+func parseSize(value string) (int64, error) {
+	size, err := humanize.ParseBytes(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s: %w", value, err)
+	}
+
+	return int64(size), nil
+}
+
+// setMaxBodySize sets the number of bytes of the response bodies kept for the following steps. Both 0
+// and unlimited keep the whole bodies.
+func (p *HTTP) setMaxBodySize(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	if args["size"] == "unlimited" {
+		stepsgen[misc.ContextHTTPMaxBodySize] = int64(0)
+		return nil, nil
+	}
+
+	size, err := parseSize(args["size"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	stepsgen[misc.ContextHTTPMaxBodySize] = size
+
+	return nil, nil
+}
+
+// setBodyChecksum hashes the following response bodies while they are read, so the checksum of the
+// bodies bigger than the max body size can be checked.
+func (p *HTTP) setBodyChecksum(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	stepsgen[misc.ContextHTTPBodyChecksum] = args["algorithm"]
+
+	return nil, nil
+}
+
+// bodyChecksumShouldBe checks the checksum of the whole response body.
+func (p *HTTP) bodyChecksumShouldBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	body, ok := stepsgen[misc.ContextHTTPResponseBody].(*responseBody)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	checksum, err := body.checksumOf(args["algorithm"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(checksum, args["checksum"]) {
+		return nil, fmt.Errorf("expected %s checksum %s, got %s", args["algorithm"], args["checksum"], checksum)
+	}
+
+	return nil, nil
+}
+
+// bodySizeShouldBeBetween checks the size of the whole response body.
+func (p *HTTP) bodySizeShouldBeBetween(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	body, ok := stepsgen[misc.ContextHTTPResponseBody].(*responseBody)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	if args["min"] == "" && args["max"] == "" {
+		return nil, fmt.Errorf("either min or max must be given")
+	}
+
+	if args["min"] != "" {
+		minSize, err := parseSize(args["min"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if body.size < minSize {
+			return nil, fmt.Errorf("expected body of at least %d bytes, got %d", minSize, body.size)
+		}
+	}
+
+	if args["max"] != "" {
+		maxSize, err := parseSize(args["max"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if body.size > maxSize {
+			return nil, fmt.Errorf("expected body of at most %d bytes, got %d", maxSize, body.size)
+		}
+	}
+
+	return nil, nil
+}
+
+// throughputShouldBeGreaterThan checks the download speed of the response body.
+func (p *HTTP) throughputShouldBeGreaterThan(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	body, ok := stepsgen[misc.ContextHTTPResponseBody].(*responseBody)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	minThroughput, err := parseSize(args["bytesPerSecond"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if body.throughput < float64(minThroughput) {
+		return nil, fmt.Errorf("expected throughput greater than %d bytes/s, got %.0f", minThroughput, body.throughput)
+	}
+
+	return nil, nil
+}
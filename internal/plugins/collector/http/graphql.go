@@ -0,0 +1,142 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+// graphQLRequest is the body of a GraphQL request.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+}
+
+// graphQLError is an error of a GraphQL response.
+type graphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path"`
+}
+
+// graphQLResponse is the body of a GraphQL response.
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []graphQLError  `json:"errors"`
+}
+
+// graphQLBody returns the JSON body of a GraphQL request.
+func graphQLBody(args map[string]string, stepsgen map[string]any) ([]byte, error) {
+	if (args["query"] == "") == (args["queryFile"] == "") {
+		return nil, fmt.Errorf("either query or queryFile must be given")
+	}
+
+	request := graphQLRequest{
+		Query:         args["query"],
+		OperationName: args["operationName"],
+	}
+
+	if args["queryFile"] != "" {
+		query, err := os.ReadFile(samplePath(stepsgen, args["queryFile"]))
+
+		if err != nil {
+			return nil, err
+		}
+
+		request.Query = string(query)
+	}
+
+	if args["variables"] != "" {
+		if err := json.Unmarshal([]byte(args["variables"]), &request.Variables); err != nil {
+			return nil, fmt.Errorf("invalid variables, expected a JSON object: %w", err)
+		}
+	}
+
+	return json.Marshal(request)
+}
+
+// graphQLErrorMessages returns the messages of the errors of a GraphQL response, with their path.
+func graphQLErrorMessages(errs []graphQLError) []string {
+	messages := make([]string, 0, len(errs))
+
+	for _, e := range errs {
+		if len(e.Path) == 0 {
+			messages = append(messages, e.Message)
+			continue
+		}
+
+		path := make([]string, 0, len(e.Path))
+
+		for _, segment := range e.Path {
+			path = append(path, fmt.Sprint(segment))
+		}
+
+		messages = append(messages, fmt.Sprintf("%s: %s", strings.Join(path, "."), e.Message))
+	}
+
+	return messages
+}
+
+// graphql sends a GraphQL query. The step fails if the response has errors, otherwise the output is
+// replaced by the data of the response, so JSONPath assertions and extractors work on it.
+func (p *HTTP) graphql(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	body, err := graphQLBody(args, stepsgen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stepsgen[misc.ContextHTTPMethod] = "POST"
+	stepsgen[misc.ContextHTTPURL] = args["url"]
+	stepsgen[misc.ContextHTTPBody] = string(body)
+
+	customMetrics, err := p.requestByMethod(ctx, map[string]string{
+		"body":        string(body),
+		"contentType": "application/json",
+		"proxy":       args["proxy"],
+	}, stepsgen)
+
+	if err != nil {
+		return customMetrics, err
+	}
+
+	output, ok := stepsgen[misc.ContextOutput].([]byte)
+
+	if !ok {
+		return customMetrics, errContextNotFound
+	}
+
+	response := graphQLResponse{}
+
+	if err := json.NewDecoder(bytes.NewReader(output)).Decode(&response); err != nil {
+		return customMetrics, fmt.Errorf("invalid GraphQL response: %w", err)
+	}
+
+	customMetrics = append(customMetrics, &metrics.Metric{
+		Name:        "http_graphql_errors",
+		Description: "The number of errors of the GraphQL response",
+		Value:       float64(len(response.Errors)),
+		Labels: map[string]string{
+			"method": stepsgen[misc.ContextHTTPMethod].(string),
+			"url":    stepsgen[misc.ContextHTTPURL].(string),
+		},
+	})
+
+	if len(response.Errors) > 0 {
+		return customMetrics, fmt.Errorf("GraphQL response has errors:\n%s", strings.Join(graphQLErrorMessages(response.Errors), "\n"))
+	}
+
+	if len(response.Data) == 0 {
+		return customMetrics, fmt.Errorf("GraphQL response has no data")
+	}
+
+	stepsgen[misc.ContextOutput] = []byte(response.Data)
+
+	return customMetrics, nil
+}
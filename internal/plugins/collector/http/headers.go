@@ -0,0 +1,203 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+// responseHeader returns the values of a response header, and false if the header is missing.
+func responseHeader(stepsgen map[string]any, key string) (string, bool, error) {
+	resp, ok := stepsgen[misc.ContextHTTPResponse].(*http.Response)
+
+	if !ok {
+		return "", false, errContextNotFound
+	}
+
+	values, ok := resp.Header[http.CanonicalHeaderKey(key)]
+
+	return strings.Join(values, ", "), ok, nil
+}
+
+// requiredResponseHeader returns the values of a response header, failing if the header is missing.
+func requiredResponseHeader(stepsgen map[string]any, key string) (string, error) {
+	value, ok, err := responseHeader(stepsgen, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", fmt.Errorf("header %s not found", key)
+	}
+
+	return value, nil
+}
+
+// headerShouldExist checks if the response has a header.
+func (p *HTTP) headerShouldExist(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	_, err := requiredResponseHeader(stepsgen, args["key"])
+
+	return nil, err
+}
+
+// headerShouldNotExist checks if the response doesn't have a header.
+func (p *HTTP) headerShouldNotExist(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, ok, err := responseHeader(stepsgen, args["key"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return nil, fmt.Errorf("expected header %s to not exist, got %s", args["key"], value)
+	}
+
+	return nil, nil
+}
+
+// headerShouldBe checks if a response header has the expected value.
+func (p *HTTP) headerShouldBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := requiredResponseHeader(stepsgen, args["key"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if value != args["value"] {
+		return nil, fmt.Errorf("expected header %s to be %s, got %s", args["key"], args["value"], value)
+	}
+
+	return nil, nil
+}
+
+// headerShouldMatch checks if a response header matches a regular expression.
+func (p *HTTP) headerShouldMatch(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := requiredResponseHeader(stepsgen, args["key"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(args["regex"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !re.MatchString(value) {
+		return nil, fmt.Errorf("expected header %s to match %s, got %s", args["key"], args["regex"], value)
+	}
+
+	return nil, nil
+}
+
+// hstsShouldBeEnabled checks the Strict-Transport-Security header.
+func (p *HTTP) hstsShouldBeEnabled(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := requiredResponseHeader(stepsgen, "Strict-Transport-Security")
+
+	if err != nil {
+		return nil, err
+	}
+
+	minMaxAge, err := strconv.ParseInt(args["minMaxAge"], 10, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxAge := int64(-1)
+	includeSubDomains := false
+
+	for _, directive := range strings.Split(value, ";") {
+		name, directiveValue, _ := strings.Cut(strings.TrimSpace(directive), "=")
+
+		switch strings.ToLower(name) {
+		case "max-age":
+			maxAge, err = strconv.ParseInt(strings.Trim(directiveValue, `"`), 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid HSTS max-age %s", directiveValue)
+			}
+		case "includesubdomains":
+			includeSubDomains = true
+		}
+	}
+
+	hstsMetrics := []*metrics.Metric{
+		{
+			Name:        "http_response_hsts_max_age",
+			Description: "The max-age of the HTTP Strict-Transport-Security header",
+			Value:       float64(maxAge),
+			Labels: map[string]string{
+				"method": stepsgen[misc.ContextHTTPMethod].(string),
+				"url":    stepsgen[misc.ContextHTTPURL].(string),
+			},
+		},
+	}
+
+	if maxAge < minMaxAge {
+		return hstsMetrics, fmt.Errorf("HSTS max-age is %d, expected at least %d", maxAge, minMaxAge)
+	}
+
+	requireSubDomains, _ := strconv.ParseBool(args["includeSubDomains"])
+
+	if requireSubDomains && !includeSubDomains {
+		return hstsMetrics, fmt.Errorf("HSTS doesn't include subdomains")
+	}
+
+	return hstsMetrics, nil
+}
+
+// cspShouldBePresent checks if the response has a Content-Security-Policy. When the header is sent
+// more than once, the directive can be in any of the policies.
+func (p *HTTP) cspShouldBePresent(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	if _, err := requiredResponseHeader(stepsgen, "Content-Security-Policy"); err != nil {
+		return nil, err
+	}
+
+	resp := stepsgen[misc.ContextHTTPResponse].(*http.Response)
+	values := resp.Header.Values("Content-Security-Policy")
+	directive := args["directive"]
+
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("header Content-Security-Policy is empty")
+		}
+
+		for _, policy := range strings.Split(value, ";") {
+			name, _, _ := strings.Cut(strings.TrimSpace(policy), " ")
+
+			if directive != "" && strings.EqualFold(name, directive) {
+				return nil, nil
+			}
+		}
+	}
+
+	if directive != "" {
+		return nil, fmt.Errorf("Content-Security-Policy doesn't have the %s directive", directive)
+	}
+
+	return nil, nil
+}
+
+// contentTypeOptionsShouldBeNosniff checks if the X-Content-Type-Options header is nosniff.
+func (p *HTTP) contentTypeOptionsShouldBeNosniff(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := requiredResponseHeader(stepsgen, "X-Content-Type-Options")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(value), "nosniff") {
+		return nil, fmt.Errorf("expected header X-Content-Type-Options to be nosniff, got %s", value)
+	}
+
+	return nil, nil
+}
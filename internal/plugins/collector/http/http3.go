@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Transport returns a transport making the requests over QUIC.
+func newHTTP3Transport(tlsConfig *tls.Config) *http3.Transport {
+	return &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		Dial:            dialQUIC,
+	}
+}
+
+// dialQUIC opens a QUIC connection, to the forced IP if any, reporting it to the trace of the request.
+// The host is resolved here, so the lookup is traced like the ones of the HTTP/1.1 and HTTP/2 transport.
+func dialQUIC(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Conn, error) {
+	host, port, err := net.SplitHostPort(dialAddress(ctx, addr))
+
+	if err != nil {
+		return nil, err
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+
+	if net.ParseIP(host) == nil {
+		if trace != nil && trace.DNSStart != nil {
+			trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+		if trace != nil && trace.DNSDone != nil {
+			trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		host = addrs[0].IP.String()
+	}
+
+	addr = net.JoinHostPort(host, port)
+
+	// QUIC sets up the connection and TLS in the same handshake, so the connect and TLS handshake times
+	// both cover it.
+	if trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart("udp", addr)
+	}
+
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+
+	conn, err := quic.DialAddrEarly(ctx, addr, tlsConfig, quicConfig)
+
+	state := tls.ConnectionState{}
+
+	if conn != nil {
+		state = conn.ConnectionState().TLS
+	}
+
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(state, err)
+	}
+
+	if trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone("udp", addr, err)
+	}
+
+	return conn, err
+}
+
+// protocolVersion returns the HTTP version of a response, like 1.1, 2 or 3.
+func protocolVersion(resp *http.Response) string {
+	if resp.ProtoMajor == 1 {
+		return fmt.Sprintf("1.%d", resp.ProtoMinor)
+	}
+
+	return fmt.Sprint(resp.ProtoMajor)
+}
+
+// protocolShouldBe checks the HTTP version of the response.
+func (p *HTTP) protocolShouldBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	resp, ok := stepsgen[misc.ContextHTTPResponse].(*http.Response)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	if version := protocolVersion(resp); version != args["version"] {
+		return nil, fmt.Errorf("expected HTTP/%s, got HTTP/%s", args["version"], version)
+	}
+
+	return nil, nil
+}
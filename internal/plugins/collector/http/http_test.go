@@ -2,10 +2,35 @@ package http_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
 	"github.com/hidracloud/hidra/v3/internal/plugins"
 	"github.com/hidracloud/hidra/v3/internal/plugins/collector/http"
+	"github.com/quic-go/quic-go/http3"
 )
 
 // TestRequestByMethod
@@ -51,3 +76,1317 @@ func TestHTTPRequestParameters(t *testing.T) {
 	}
 
 }
+
+func TestJSONPathAssertions(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprint(w, `{"status": "degraded", "queue": {"size": 42}, "items": [{"id": 1, "status": "up"}, {"id": 2, "status": "down"}],
+			"services": {"b": {"up": false}, "a": {"up": true}, "c": {"up": false}}, "big": 12345678901234567891}`)
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := make(map[string]any, 0)
+
+	_, err := h.RunStep(ctx, previous, &plugins.Step{
+		Name: "request",
+		Args: map[string]string{"url": server.URL},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		name    string
+		args    map[string]string
+		success bool
+	}{
+		{"jsonPathShouldExist", map[string]string{"path": "$.queue.size"}, true},
+		{"jsonPathShouldExist", map[string]string{"path": "$.queue.missing"}, false},
+		{"jsonPathShouldBe", map[string]string{"path": "$.status", "value": "ok"}, false},
+		{"jsonPathShouldBe", map[string]string{"path": "$.items[1].id", "value": "2"}, true},
+		{"jsonPathShouldMatch", map[string]string{"path": "$.status", "regex": "^deg"}, true},
+		{"jsonPathShouldBeGreaterThan", map[string]string{"path": "$.queue.size", "value": "40"}, true},
+		{"jsonPathShouldBeLowerThan", map[string]string{"path": "$.queue.size", "value": "40"}, false},
+		{"jsonPathLengthShouldBe", map[string]string{"path": "$.items", "length": "2"}, true},
+		{"jsonPathLengthShouldBe", map[string]string{"path": "$.items[*].id", "length": "2"}, true},
+		{"jsonPathShouldBe", map[string]string{"path": "$.big", "value": "12345678901234567891"}, true},
+		{"jsonPathShouldBe", map[string]string{"path": "$.services.*.up", "value": "true"}, true},
+		{"jsonPathShouldBe", map[string]string{"path": "$.services[*].up", "value": "true"}, true},
+		{"jsonPathShouldBe", map[string]string{"path": "$.items[?(@.status == 'down')].id", "value": "2"}, true},
+		{"jsonPathShouldBe", map[string]string{"path": "$.items[?(@.id > 1)].status", "value": "down"}, true},
+		{"jsonPathLengthShouldBe", map[string]string{"path": "$.items[?(@.id >= 1)].id", "length": "2"}, true},
+		{"jsonPathLengthShouldBe", map[string]string{"path": "$.services[?(@.up == false)]", "length": "2"}, true},
+		{"jsonPathShouldExist", map[string]string{"path": "$.items[?(@.missing)]"}, false},
+		{"jsonPathLengthShouldBe", map[string]string{"path": "$..id", "length": "2"}, true},
+		{"jsonPathShouldBe", map[string]string{"path": "$..size", "value": "42"}, true},
+		{"jsonPathShouldExist", map[string]string{"path": "$.items[?(@.id == 1 && @.status == 'up')]"}, false},
+	} {
+		_, err := h.RunStep(ctx, previous, &plugins.Step{Name: step.name, Args: step.args})
+
+		if (err == nil) != step.success {
+			t.Errorf("%s %v: unexpected result %v", step.name, step.args, err)
+		}
+	}
+
+	metrics, err := h.RunStep(ctx, previous, &plugins.Step{
+		Name: "jsonPathToMetric",
+		Args: map[string]string{"path": "$.queue.size", "name": "queue_size"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics) != 1 || metrics[0].Value != 42 || metrics[0].Labels["name"] != "queue_size" {
+		t.Errorf("unexpected metrics %v", metrics)
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path == "/pets/1" {
+			fmt.Fprint(w, `{"id": "1", "name": null, "kind": null}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"id": "1", "name": "hidra"}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "user.json")
+	specPath := filepath.Join(dir, "openapi.yml")
+
+	err := os.WriteFile(schemaPath, []byte(`{"type": "object", "required": ["id", "name"], "properties": {"name": {"type": "string"}}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(specPath, []byte(`
+openapi: 3.1.0
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /v1/users/{id}:
+    get:
+      responses:
+        200:
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/User"
+components:
+  schemas:
+    User:
+      type: object
+      required: [id, email]
+      properties:
+        id:
+          type: integer
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := map[string]any{}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{
+		Name: "request",
+		Args: map[string]string{"url": server.URL + "/v1/users/1"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{
+		Name: "jsonSchemaShouldMatch",
+		Args: map[string]string{"schema": schemaPath},
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{
+		Name: "openAPIShouldMatch",
+		Args: map[string]string{"spec": specPath},
+	})
+
+	if err == nil {
+		t.Fatal("expected the response to violate the OpenAPI document")
+	}
+
+	for _, expected := range []string{"at '': missing property 'email'", "at '/id': got string, want integer"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %q", expected, err.Error())
+		}
+	}
+
+	// Paths are relative to the sample, and nullable is supported in OpenAPI 3.0 documents.
+	err = os.MkdirAll(filepath.Join(dir, "specs"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "specs", "pets.yml"), []byte(`
+openapi: 3.0.3
+paths:
+  /pets/{id}:
+    get:
+      responses:
+        200:
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, name, kind]
+                properties:
+                  id:
+                    type: string
+                  name:
+                    type: string
+                    nullable: true
+                  kind:
+                    type: string
+                    enum: [cat, dog]
+                    nullable: true
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous = map[string]any{misc.ContextSamplePath: filepath.Join(dir, "sample.yml")}
+
+	for _, step := range []*plugins.Step{
+		{Name: "request", Args: map[string]string{"url": server.URL + "/pets/1"}},
+		{Name: "openAPIShouldMatch", Args: map[string]string{"spec": "specs/pets.yml"}},
+		{Name: "openAPIShouldMatch", Args: map[string]string{"spec": "specs/pets.yml"}},
+	} {
+		if _, err := h.RunStep(ctx, previous, step); err != nil {
+			t.Fatalf("%s: %s", step.Name, err)
+		}
+	}
+}
+
+func TestHeaderAssertions(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path == "/nosubdomains" {
+			w.Header().Set("Strict-Transport-Security", "max-age=15552000")
+			return
+		}
+
+		w.Header().Set("Strict-Transport-Security", "max-age=15552000; includeSubDomains")
+		w.Header().Add("Content-Security-Policy", "default-src 'self'; img-src *")
+		w.Header().Add("Content-Security-Policy", "script-src 'self'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "no-store")
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := map[string]any{}
+
+	_, err := h.RunStep(ctx, previous, &plugins.Step{
+		Name: "request",
+		Args: map[string]string{"url": server.URL},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		name    string
+		args    map[string]string
+		success bool
+	}{
+		{"headerShouldExist", map[string]string{"key": "cache-control"}, true},
+		{"headerShouldExist", map[string]string{"key": "X-Frame-Options"}, false},
+		{"headerShouldNotExist", map[string]string{"key": "Server"}, true},
+		{"headerShouldNotExist", map[string]string{"key": "Cache-Control"}, false},
+		{"headerShouldBe", map[string]string{"key": "Cache-Control", "value": "no-store"}, true},
+		{"headerShouldBe", map[string]string{"key": "Cache-Control", "value": "no-cache"}, false},
+		{"headerShouldMatch", map[string]string{"key": "Strict-Transport-Security", "regex": "max-age=\\d+"}, true},
+		{"headerShouldMatch", map[string]string{"key": "Cache-Control", "regex": "^private"}, false},
+		{"hstsShouldBeEnabled", map[string]string{}, false},
+		{"hstsShouldBeEnabled", map[string]string{"minMaxAge": "86400", "includeSubDomains": "true"}, true},
+		{"hstsShouldBeEnabled", map[string]string{"minMaxAge": "86400", "includeSubDomains": "True"}, true},
+		{"cspShouldBePresent", map[string]string{}, true},
+		{"cspShouldBePresent", map[string]string{"directive": "img-src"}, true},
+		{"cspShouldBePresent", map[string]string{"directive": "script-src"}, true},
+		{"cspShouldBePresent", map[string]string{"directive": "frame-ancestors"}, false},
+		{"contentTypeOptionsShouldBeNosniff", map[string]string{}, true},
+		{"request", map[string]string{"url": server.URL + "/nosubdomains"}, true},
+		{"hstsShouldBeEnabled", map[string]string{"minMaxAge": "86400", "includeSubDomains": "false"}, true},
+		{"hstsShouldBeEnabled", map[string]string{"minMaxAge": "86400", "includeSubDomains": "1"}, false},
+	} {
+		_, err := h.RunStep(ctx, previous, &plugins.Step{Name: step.name, Args: step.args})
+
+		if (err == nil) != step.success {
+			t.Errorf("%s %v: unexpected result %v", step.name, step.args, err)
+		}
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key.
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hidra"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client-key.pem")
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestTLSVerification(t *testing.T) {
+	server := httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+
+	err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := writeClientCertificate(t, dir)
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	metrics, err := h.RunStep(ctx, map[string]any{}, &plugins.Step{
+		Name: "request",
+		Args: map[string]string{"url": server.URL},
+	})
+
+	if err == nil {
+		t.Fatal("expected the certificate to be rejected")
+	}
+
+	if len(metrics) != 1 || metrics[0].Name != "http_tls_verification_failure" || metrics[0].Labels["reason"] != "unknown_authority" {
+		t.Errorf("unexpected metrics %v", metrics)
+	}
+
+	for _, setup := range []*plugins.Step{
+		{Name: "allowInsecureTLS"},
+		{Name: "setCACertificate", Args: map[string]string{"path": caPath}},
+	} {
+		previous := map[string]any{}
+
+		if _, err := h.RunStep(ctx, previous, setup); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL}}); err != nil {
+			t.Errorf("%s: %v", setup.Name, err)
+		}
+	}
+
+	// Paths are relative to the sample.
+	previous := map[string]any{misc.ContextSamplePath: filepath.Join(dir, "sample.yml")}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{Name: "setCACertificate", Args: map[string]string{"path": "ca.pem"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{Name: "setClientCertificate", Args: map[string]string{"cert": filepath.Base(certPath), "key": filepath.Base(keyPath)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output, _ := previous[misc.ContextOutput].([]byte); string(output) != "hidra" {
+		t.Errorf("expected the client certificate to be sent, got %q", output)
+	}
+}
+
+func TestSampleClient(t *testing.T) {
+	var connections atomic.Int32
+
+	server := httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		fmt.Fprint(w, r.Proto)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state nethttp.ConnState) {
+		if state == nethttp.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	run := func(previous map[string]any, steps ...*plugins.Step) error {
+		for _, step := range steps {
+			if _, err := h.RunStep(ctx, previous, step); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	request := func(path string) *plugins.Step {
+		return &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL + path}}
+	}
+
+	insecure := &plugins.Step{Name: "allowInsecureTLS"}
+
+	for _, test := range []struct {
+		name        string
+		samples     [][]*plugins.Step
+		connections int32
+	}{
+		{"same sample", [][]*plugins.Step{{insecure, request("/"), request("/")}}, 1},
+		{"two samples", [][]*plugins.Step{{insecure, request("/")}, {insecure, request("/")}}, 2},
+		{"fresh connection", [][]*plugins.Step{{insecure, {Name: "freshConnection"}, request("/"), request("/")}}, 2},
+	} {
+		connections.Store(0)
+
+		for _, steps := range test.samples {
+			if err := run(map[string]any{}, steps...); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if connections.Load() != test.connections {
+			t.Errorf("%s: expected %d connections, got %d", test.name, test.connections, connections.Load())
+		}
+	}
+
+	// The runner always sets the timeout of the sample.
+	err := run(map[string]any{misc.ContextTimeout: time.Minute}, insecure, &plugins.Step{Name: "setTimeout", Args: map[string]string{"timeout": "50ms"}}, request("/slow"))
+
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected the request to time out, got %v", err)
+	}
+
+	if err := run(map[string]any{misc.ContextTimeout: time.Minute}, insecure, request("/slow")); err != nil {
+		t.Errorf("expected the sample timeout to be used, got %v", err)
+	}
+
+	for version, proto := range map[string]string{"1.1": "HTTP/1.1", "2": "HTTP/2.0"} {
+		previous := map[string]any{}
+
+		err := run(previous, insecure, &plugins.Step{Name: "setHTTPVersion", Args: map[string]string{"version": version}}, request("/"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output, _ := previous[misc.ContextOutput].([]byte); string(output) != proto {
+			t.Errorf("expected %s, got %s", proto, output)
+		}
+	}
+
+	proxy := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+
+	previous := map[string]any{}
+
+	err = run(previous, &plugins.Step{Name: "setProxy", Args: map[string]string{"url": proxy.URL}}, &plugins.Step{Name: "request", Args: map[string]string{"url": "http://hidra.example/"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output, _ := previous[misc.ContextOutput].([]byte); string(output) != "proxied http://hidra.example/" {
+		t.Errorf("expected the request to go through the proxy, got %s", output)
+	}
+}
+
+func TestCookies(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		switch r.URL.Path {
+		case "/login":
+			nethttp.SetCookie(w, &nethttp.Cookie{Name: "session", Value: "s3cr3t", Path: "/", HttpOnly: true, SameSite: nethttp.SameSiteLaxMode})
+		case "/sso":
+			nethttp.SetCookie(w, &nethttp.Cookie{Name: "sso", Value: "t0k3n", Path: "/", Secure: true})
+			nethttp.Redirect(w, r, "/home", nethttp.StatusFound)
+		case "/private":
+			session, err := r.Cookie("session")
+
+			if err != nil || session.Value != "s3cr3t" {
+				w.WriteHeader(nethttp.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := map[string]any{}
+
+	for _, step := range []struct {
+		name    string
+		args    map[string]string
+		success bool
+	}{
+		{"request", map[string]string{"url": server.URL + "/login"}, true},
+		{"cookieShouldBeSet", map[string]string{"name": "session", "value": "s3cr3t", "httpOnly": "true", "sameSite": "Lax"}, true},
+		{"cookieShouldBeSet", map[string]string{"name": "session", "secure": "true"}, false},
+		{"request", map[string]string{"url": server.URL + "/private"}, true},
+		{"statusCodeShouldBe", map[string]string{"statusCode": "401"}, true},
+		{"cookieShouldBeSent", map[string]string{"name": "session"}, false},
+		{"enableCookies", map[string]string{}, true},
+		{"request", map[string]string{"url": server.URL + "/login"}, true},
+		{"cookieShouldBeSent", map[string]string{"name": "session", "value": "s3cr3t"}, true},
+		{"request", map[string]string{"url": server.URL + "/private"}, true},
+		{"statusCodeShouldBe", map[string]string{"statusCode": "200"}, true},
+		{"clearCookies", map[string]string{}, true},
+		{"cookieShouldBeSent", map[string]string{"name": "session"}, false},
+		{"request", map[string]string{"url": server.URL + "/private"}, true},
+		{"statusCodeShouldBe", map[string]string{"statusCode": "401"}, true},
+		{"setCookie", map[string]string{"name": "session", "value": "s3cr3t", "path": "/"}, true},
+		{"request", map[string]string{"url": server.URL + "/private"}, true},
+		{"statusCodeShouldBe", map[string]string{"statusCode": "200"}, true},
+		{"followRedirects", map[string]string{}, true},
+		{"request", map[string]string{"url": server.URL + "/sso"}, true},
+		{"statusCodeShouldBe", map[string]string{"statusCode": "200"}, true},
+		{"cookieShouldBeSet", map[string]string{"name": "sso", "value": "t0k3n", "secure": "true"}, true},
+		{"request", map[string]string{"url": server.URL + "/private"}, true},
+		{"cookieShouldBeSet", map[string]string{"name": "sso"}, false},
+	} {
+		_, err := h.RunStep(ctx, previous, &plugins.Step{Name: step.name, Args: step.args})
+
+		if (err == nil) != step.success {
+			t.Fatalf("%s %v: unexpected result %v", step.name, step.args, err)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	var tokenRequests atomic.Int32
+
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests.Add(1)
+
+			id, secret, _ := r.BasicAuth()
+
+			if id != "hidra" || secret != "s3cr3t" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(nethttp.StatusUnauthorized)
+				fmt.Fprintf(w, `{"error": "invalid_client", "error_description": "wrong secret %s"}`, secret)
+				return
+			}
+
+			fmt.Fprintf(w, `{"access_token": "token-%s", "token_type": "bearer", "expires_in": 3600}`, r.FormValue("scope"))
+			return
+		}
+
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	oauth2 := func(scope, secret string) *plugins.Step {
+		return &plugins.Step{Name: "oauth2Token", Args: map[string]string{
+			"tokenURL":     server.URL + "/token",
+			"clientID":     "hidra",
+			"clientSecret": secret,
+			"scope":        scope,
+		}}
+	}
+
+	for _, test := range []struct {
+		steps         []*plugins.Step
+		authorization string
+	}{
+		{[]*plugins.Step{{Name: "basicAuth", Args: map[string]string{"username": "hidra", "password": "s3cr3t"}}}, "Basic aGlkcmE6czNjcjN0"},
+		{[]*plugins.Step{{Name: "bearerToken", Args: map[string]string{"token": "abc"}}}, "Bearer abc"},
+		{[]*plugins.Step{{Name: "bearerToken", Args: map[string]string{"token": "abc"}}, {Name: "clearAuth"}}, ""},
+		{[]*plugins.Step{oauth2("read", "s3cr3t")}, "Bearer token-read"},
+		{[]*plugins.Step{oauth2("read", "s3cr3t")}, "Bearer token-read"},
+		{[]*plugins.Step{oauth2("write", "s3cr3t")}, "Bearer token-write"},
+	} {
+		previous := map[string]any{}
+
+		for _, step := range test.steps {
+			if _, err := h.RunStep(ctx, previous, step); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL}})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output, _ := previous[misc.ContextOutput].([]byte); string(output) != test.authorization {
+			t.Errorf("expected authorization %q, got %q", test.authorization, output)
+		}
+	}
+
+	if tokenRequests.Load() != 2 {
+		t.Errorf("expected the tokens to be cached, got %d token requests", tokenRequests.Load())
+	}
+
+	_, err := h.RunStep(ctx, map[string]any{}, oauth2("read", "wrong"))
+
+	if err == nil || !strings.Contains(err.Error(), "invalid_client") || strings.Contains(err.Error(), "wrong secret") {
+		t.Errorf("expected the token request to fail with the error code only, got %v", err)
+	}
+}
+
+func TestTimingBreakdown(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "hello")
+		w.(nethttp.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, " world")
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := map[string]any{}
+
+	for i, reused := range []float64{0, 1} {
+		stepMetrics, err := h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL}})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := map[string]float64{}
+
+		for _, metric := range stepMetrics {
+			values[metric.Name] = metric.Value
+		}
+
+		for _, name := range []string{"http_response_ttfb_time", "http_response_server_processing_time", "http_response_content_transfer_time"} {
+			if values[name] < 0.05 {
+				t.Errorf("request %d: expected %s to be at least 50ms, got %f", i, name, values[name])
+			}
+		}
+
+		if values["http_response_ttfb_time"] > values["http_response_time"] {
+			t.Errorf("request %d: TTFB %f is greater than the response time %f", i, values["http_response_ttfb_time"], values["http_response_time"])
+		}
+
+		if values["http_response_connection_reused"] != reused {
+			t.Errorf("request %d: expected connection reused %f, got %f", i, reused, values["http_response_connection_reused"])
+		}
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	mux := nethttp.NewServeMux()
+	mux.Handle("/old", nethttp.RedirectHandler("/new", nethttp.StatusMovedPermanently))
+	mux.Handle("/new", nethttp.RedirectHandler("/final", nethttp.StatusFound))
+	mux.Handle("/loop", nethttp.RedirectHandler("/loop", nethttp.StatusFound))
+	mux.HandleFunc("/login", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			nethttp.Redirect(w, r, "/sso", nethttp.StatusFound)
+			return
+		}
+
+		fmt.Fprint(w, "logged in")
+	})
+	mux.HandleFunc("/sso", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		nethttp.SetCookie(w, &nethttp.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		nethttp.Redirect(w, r, "/login", nethttp.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprint(w, "final")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := map[string]any{}
+
+	_, err := h.RunStep(ctx, previous, &plugins.Step{Name: "followRedirects"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stepMetrics, err := h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL + "/old"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redirects := -1.0
+
+	for _, metric := range stepMetrics {
+		if metric.Name == "http_response_redirects" {
+			redirects = metric.Value
+		}
+	}
+
+	if redirects != 2 {
+		t.Errorf("expected 2 redirects, got %f", redirects)
+	}
+
+	for _, step := range []struct {
+		name    string
+		args    map[string]string
+		success bool
+	}{
+		{"maxRedirects", map[string]string{"max": "2"}, true},
+		{"maxRedirects", map[string]string{"max": "1"}, false},
+		{"finalURLShouldBe", map[string]string{"url": server.URL + "/final"}, true},
+		{"finalURLShouldBe", map[string]string{"url": server.URL + "/new"}, false},
+		{"shouldRedirectChainBe", map[string]string{"urls": server.URL + "/old, " + server.URL + "/new, " + server.URL + "/final"}, true},
+		{"shouldRedirectChainBe", map[string]string{"urls": server.URL + "/old, " + server.URL + "/final"}, false},
+	} {
+		_, err := h.RunStep(ctx, previous, &plugins.Step{Name: step.name, Args: step.args})
+
+		if (err == nil) != step.success {
+			t.Errorf("%s %v: unexpected result %v", step.name, step.args, err)
+		}
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL + "/loop"}})
+
+	if err == nil || !strings.Contains(err.Error(), "stopped after 10 redirects") {
+		t.Errorf("expected a redirect loop to be stopped, got %v", err)
+	}
+
+	// going back to the first URL after getting a cookie isn't a loop
+	for _, step := range []*plugins.Step{
+		{Name: "enableCookies"},
+		{Name: "request", Args: map[string]string{"url": server.URL + "/login"}},
+		{Name: "statusCodeShouldBe", Args: map[string]string{"statusCode": "200"}},
+		{Name: "maxRedirects", Args: map[string]string{"max": "2"}},
+	} {
+		if _, err := h.RunStep(ctx, previous, step); err != nil {
+			t.Fatalf("%s: %v", step.Name, err)
+		}
+	}
+}
+
+func TestRequestBodies(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		contentType := r.Header.Get("Content-Type")
+
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				w.WriteHeader(nethttp.StatusBadRequest)
+				return
+			}
+
+			file, header, err := r.FormFile("report")
+			if err != nil {
+				w.WriteHeader(nethttp.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			data, _ := io.ReadAll(file)
+			fmt.Fprintf(w, "%s %s %s %s", r.FormValue("title"), header.Filename, header.Header.Get("Content-Type"), data)
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", contentType, data)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "files", "payload.json"), []byte(`{"name": "hidra"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	for _, test := range []struct {
+		args   map[string]string
+		output string
+	}{
+		{map[string]string{"body": "raw"}, " raw"},
+		{map[string]string{"body": "raw", "contentType": "text/plain"}, "text/plain raw"},
+		{map[string]string{"bodyFile": "files/payload.json"}, `application/json {"name": "hidra"}`},
+		{map[string]string{"form": "name=hidra&lang=go"}, "application/x-www-form-urlencoded lang=go&name=hidra"},
+		{map[string]string{"multipartFields": "title=Report", "multipartFiles": "report=files/payload.json"}, `Report payload.json application/json {"name": "hidra"}`},
+	} {
+		previous := map[string]any{misc.ContextSamplePath: filepath.Join(dir, "sample.yml")}
+		test.args["method"] = "POST"
+		test.args["url"] = server.URL
+
+		if _, err := h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: test.args}); err != nil {
+			t.Fatal(err)
+		}
+
+		if output, _ := previous[misc.ContextOutput].([]byte); string(output) != test.output {
+			t.Errorf("%v: expected %q, got %q", test.args, test.output, output)
+		}
+	}
+
+	_, err := h.RunStep(ctx, map[string]any{}, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL, "body": "raw", "form": "a=b"}})
+
+	if err == nil {
+		t.Error("expected an error with two bodies")
+	}
+}
+
+func TestConnectProxy(t *testing.T) {
+	server := httptest.NewTLSServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprint(w, "target")
+	}))
+	defer server.Close()
+
+	var tunnels atomic.Int32
+
+	proxy := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if user, password, ok := parseProxyAuthorization(r); !ok || user != "hidra" || password != "s3cr3t" {
+			w.WriteHeader(nethttp.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method != nethttp.MethodConnect {
+			w.WriteHeader(nethttp.StatusMethodNotAllowed)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(nethttp.StatusBadGateway)
+			return
+		}
+
+		conn, _, err := w.(nethttp.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+
+		tunnels.Add(1)
+		fmt.Fprint(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+
+		go func() {
+			_, _ = io.Copy(target, conn)
+			target.Close()
+		}()
+
+		_, _ = io.Copy(conn, target)
+		conn.Close()
+	}))
+	defer proxy.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	if _, err := h.RunStep(ctx, map[string]any{}, &plugins.Step{Name: "setProxy", Args: map[string]string{"url": "ftp://proxy:21"}}); err == nil {
+		t.Error("expected an unsupported proxy scheme to fail")
+	}
+
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://hidra:s3cr3t@", 1)
+
+	for _, steps := range [][]*plugins.Step{
+		{{Name: "setProxy", Args: map[string]string{"url": proxyURL}}, {Name: "request", Args: map[string]string{"url": server.URL}}},
+		{{Name: "request", Args: map[string]string{"url": server.URL, "proxy": proxyURL}}},
+	} {
+		previous := map[string]any{}
+		var stepMetrics []*metrics.Metric
+
+		for _, step := range append([]*plugins.Step{{Name: "allowInsecureTLS"}}, steps...) {
+			newMetrics, err := h.RunStep(ctx, previous, step)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stepMetrics = append(stepMetrics, newMetrics...)
+		}
+
+		if output, _ := previous[misc.ContextOutput].([]byte); string(output) != "target" {
+			t.Errorf("unexpected output %s", output)
+		}
+
+		found := false
+
+		for _, metric := range stepMetrics {
+			found = found || metric.Name == "http_response_proxy_connect_time"
+		}
+
+		if !found {
+			t.Error("expected the proxy connect time metric")
+		}
+	}
+
+	if tunnels.Load() != 2 {
+		t.Errorf("expected 2 tunnels, got %d", tunnels.Load())
+	}
+}
+
+// parseProxyAuthorization returns the credentials of the Proxy-Authorization header.
+func parseProxyAuthorization(r *nethttp.Request) (string, string, bool) {
+	r2 := &nethttp.Request{Header: nethttp.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+
+	return r2.BasicAuth()
+}
+
+func TestProbeAddresses(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	for _, test := range []struct {
+		args    map[string]string
+		success bool
+	}{
+		{map[string]string{"probe": "ips"}, true},
+		{map[string]string{"requiredFamilies": "ipv4"}, true},
+		{map[string]string{"requiredFamilies": "ipv6, ipv4"}, false},
+	} {
+		test.args["url"] = server.URL
+
+		stepMetrics, err := h.RunStep(ctx, map[string]any{}, &plugins.Step{Name: "request", Args: test.args})
+
+		if (err == nil) != test.success {
+			t.Errorf("%v: unexpected result %v", test.args, err)
+		}
+
+		probes := 0
+
+		for _, metric := range stepMetrics {
+			if metric.Name == "http_probe_success" {
+				probes++
+
+				if metric.Value != 1 || metric.Labels["family"] != "ipv4" || metric.Labels["ip"] != "127.0.0.1" {
+					t.Errorf("%v: unexpected probe %v", test.args, metric.Labels)
+				}
+			}
+		}
+
+		if probes != 1 {
+			t.Errorf("%v: expected 1 probe, got %d", test.args, probes)
+		}
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	handler := nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	// Listen on every address, so the server is reachable whatever localhost resolves to.
+	conn, err := net.ListenPacket("udp", ":0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	quicURL := fmt.Sprintf("https://localhost:%d", conn.LocalAddr().(*net.UDPAddr).Port)
+
+	quicServer := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: tlsServer.TLS.Certificates}),
+	}
+	defer quicServer.Close()
+
+	go func() {
+		_ = quicServer.Serve(conn)
+	}()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	for _, test := range []struct {
+		version string
+		url     string
+		proto   string
+	}{
+		{"1.1", tlsServer.URL, "HTTP/1.1"},
+		{"2", tlsServer.URL, "HTTP/2.0"},
+		{"3", quicURL, "HTTP/3.0"},
+	} {
+		previous := map[string]any{}
+
+		var protocol string
+
+		timings := map[string]float64{}
+
+		for _, step := range []*plugins.Step{
+			{Name: "allowInsecureTLS"},
+			{Name: "setHTTPVersion", Args: map[string]string{"version": test.version}},
+			{Name: "request", Args: map[string]string{"url": test.url}},
+			{Name: "protocolShouldBe", Args: map[string]string{"version": test.version}},
+		} {
+			stepMetrics, err := h.RunStep(ctx, previous, step)
+
+			if err != nil {
+				t.Fatalf("%s: %s", test.version, err)
+			}
+
+			for _, metric := range stepMetrics {
+				if metric.Name == "http_response_protocol" {
+					protocol = metric.Labels["protocol"]
+				}
+
+				if metric.Name == "http_response_dns_time" || metric.Name == "http_response_tcp_connect_time" {
+					timings[metric.Name] = metric.Value
+				}
+			}
+		}
+
+		if output, _ := previous[misc.ContextOutput].([]byte); string(output) != test.proto {
+			t.Errorf("expected %s, got %s", test.proto, output)
+		}
+
+		if protocol != test.version {
+			t.Errorf("expected the protocol label %s, got %s", test.version, protocol)
+		}
+
+		if test.version == "3" && (timings["http_response_dns_time"] <= 0 || timings["http_response_tcp_connect_time"] <= 0) {
+			t.Errorf("expected the DNS and connect times of the QUIC connection, got %v", timings)
+		}
+
+		if _, err := h.RunStep(ctx, previous, &plugins.Step{Name: "protocolShouldBe", Args: map[string]string{"version": "1.0"}}); err == nil {
+			t.Errorf("%s: expected the protocol assertion to fail", test.version)
+		}
+	}
+
+	previous := map[string]any{}
+
+	for _, step := range []*plugins.Step{
+		{Name: "setHTTPVersion", Args: map[string]string{"version": "3"}},
+		{Name: "setProxy", Args: map[string]string{"url": "http://127.0.0.1:1"}},
+	} {
+		if _, err := h.RunStep(ctx, previous, step); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := h.RunStep(ctx, previous, &plugins.Step{Name: "request", Args: map[string]string{"url": quicURL}}); err == nil {
+		t.Error("expected HTTP/3 through a proxy to fail")
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		request := struct {
+			Query         string         `json:"query"`
+			Variables     map[string]any `json:"variables"`
+			OperationName string         `json:"operationName"`
+		}{}
+
+		if r.Method != nethttp.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			nethttp.Error(w, "bad request", nethttp.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			nethttp.Error(w, err.Error(), nethttp.StatusBadRequest)
+			return
+		}
+
+		if request.Variables["id"] != "1" || request.OperationName != "User" {
+			fmt.Fprint(w, `{"data":{"user":null},"errors":[{"message":"user not found","path":["user"]}]}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"data":{"user":{"name":"hidra"}}}`)
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	query := "query User($id: ID!) { user(id: $id) { name } }"
+
+	previous := map[string]any{}
+
+	stepMetrics, err := h.RunStep(ctx, previous, &plugins.Step{Name: "graphql", Args: map[string]string{
+		"url":           server.URL,
+		"query":         query,
+		"variables":     `{"id": "1"}`,
+		"operationName": "User",
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output, _ := previous[misc.ContextOutput].([]byte); string(output) != `{"user":{"name":"hidra"}}` {
+		t.Errorf("expected the data as output, got %s", output)
+	}
+
+	if _, err := h.RunStep(ctx, previous, &plugins.Step{Name: "jsonPathShouldBe", Args: map[string]string{"path": "$.user.name", "value": "hidra"}}); err != nil {
+		t.Error(err)
+	}
+
+	for _, metric := range stepMetrics {
+		if metric.Name == "http_graphql_errors" && metric.Value != 0 {
+			t.Errorf("expected no errors, got %f", metric.Value)
+		}
+	}
+
+	_, err = h.RunStep(ctx, map[string]any{}, &plugins.Step{Name: "graphql", Args: map[string]string{
+		"url":       server.URL,
+		"query":     query,
+		"variables": `{"id": "2"}`,
+	}})
+
+	if err == nil || !strings.Contains(err.Error(), "user: user not found") {
+		t.Errorf("expected the GraphQL errors, got %v", err)
+	}
+
+	for _, args := range []map[string]string{
+		{"url": server.URL},
+		{"url": server.URL, "query": query, "variables": "[1]"},
+	} {
+		if _, err := h.RunStep(ctx, map[string]any{}, &plugins.Step{Name: "graphql", Args: args}); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	payload := []byte(strings.Repeat("hidra", 1024))
+	sha256Sum := sha256.Sum256(payload)
+	md5Sum := md5.Sum(payload)
+
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path == "/big" {
+			_, _ = w.Write(make([]byte, 11<<20))
+			return
+		}
+
+		_, _ = w.Write(payload)
+	}))
+	defer server.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	for _, test := range []struct {
+		steps []*plugins.Step
+		size  int
+	}{
+		{[]*plugins.Step{}, 10 << 20},
+		{[]*plugins.Step{{Name: "setMaxBodySize", Args: map[string]string{"size": "unlimited"}}}, 11 << 20},
+		{[]*plugins.Step{{Name: "setMaxBodySize", Args: map[string]string{"size": "0"}}}, 11 << 20},
+	} {
+		previous := map[string]any{}
+
+		for _, step := range append(test.steps, &plugins.Step{Name: "request", Args: map[string]string{"url": server.URL + "/big"}}) {
+			if _, err := h.RunStep(ctx, previous, step); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if output, _ := previous[misc.ContextOutput].([]byte); len(output) != test.size {
+			t.Errorf("expected %d bytes of output, got %d", test.size, len(output))
+		}
+	}
+
+	previous := map[string]any{}
+
+	var stepMetrics []*metrics.Metric
+
+	for _, step := range []*plugins.Step{
+		{Name: "setMaxBodySize", Args: map[string]string{"size": "1KB"}},
+		{Name: "setBodyChecksum", Args: map[string]string{}},
+		{Name: "request", Args: map[string]string{"url": server.URL}},
+	} {
+		newMetrics, err := h.RunStep(ctx, previous, step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stepMetrics = append(stepMetrics, newMetrics...)
+	}
+
+	if output, _ := previous[misc.ContextOutput].([]byte); len(output) != 1000 {
+		t.Errorf("expected 1000 bytes of output, got %d", len(output))
+	}
+
+	for _, metric := range stepMetrics {
+		switch metric.Name {
+		case "http_response_content_length":
+			if metric.Value != float64(len(payload)) {
+				t.Errorf("expected a content length of %d, got %f", len(payload), metric.Value)
+			}
+		case "http_response_body_truncated":
+			if metric.Value != 1 {
+				t.Error("expected the body to be truncated")
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		step    *plugins.Step
+		success bool
+	}{
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"checksum": hex.EncodeToString(sha256Sum[:])}}, true},
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"checksum": hex.EncodeToString(md5Sum[:])}}, false},
+		// The truncated body was only hashed with sha256.
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"algorithm": "md5", "checksum": hex.EncodeToString(md5Sum[:])}}, false},
+		{&plugins.Step{Name: "bodySizeShouldBeBetween", Args: map[string]string{"min": "5KiB", "max": "5KiB"}}, true},
+		{&plugins.Step{Name: "bodySizeShouldBeBetween", Args: map[string]string{"max": "1KB"}}, false},
+		{&plugins.Step{Name: "bodySizeShouldBeBetween", Args: map[string]string{"min": "1MB"}}, false},
+		{&plugins.Step{Name: "throughputShouldBeGreaterThan", Args: map[string]string{"bytesPerSecond": "1"}}, true},
+		{&plugins.Step{Name: "throughputShouldBeGreaterThan", Args: map[string]string{"bytesPerSecond": "1PB"}}, false},
+	} {
+		if _, err := h.RunStep(ctx, previous, test.step); (err == nil) != test.success {
+			t.Errorf("%s %v: unexpected result %v", test.step.Name, test.step.Args, err)
+		}
+	}
+
+	// The bodies kept whole are hashed on demand.
+	previous = map[string]any{}
+
+	for _, test := range []struct {
+		step    *plugins.Step
+		success bool
+	}{
+		{&plugins.Step{Name: "request", Args: map[string]string{"url": server.URL}}, true},
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"checksum": hex.EncodeToString(sha256Sum[:])}}, true},
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"algorithm": "md5", "checksum": hex.EncodeToString(md5Sum[:])}}, true},
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"algorithm": "MD5", "checksum": hex.EncodeToString(md5Sum[:])}}, true},
+		{&plugins.Step{Name: "bodyChecksumShouldBe", Args: map[string]string{"algorithm": "md5", "checksum": hex.EncodeToString(sha256Sum[:])}}, false},
+	} {
+		if _, err := h.RunStep(ctx, previous, test.step); (err == nil) != test.success {
+			t.Errorf("%s %v: unexpected result %v", test.step.Name, test.step.Args, err)
+		}
+	}
+}
+
+func TestForceIPRedirects(t *testing.T) {
+	target := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		fmt.Fprint(w, "target")
+	}))
+	defer target.Close()
+
+	targetURL := fmt.Sprintf("http://localhost:%d/", target.Listener.Addr().(*net.TCPAddr).Port)
+
+	// The forced IP only serves the redirect, the target isn't listening on it.
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	origin := httptest.NewUnstartedServer(nethttp.RedirectHandler(targetURL, nethttp.StatusFound))
+	origin.Listener.Close()
+	origin.Listener = listener
+	origin.Start()
+	defer origin.Close()
+
+	h := http.HTTP{}
+	h.Init()
+
+	ctx := context.TODO()
+	previous := map[string]any{}
+
+	for _, step := range []*plugins.Step{
+		{Name: "followRedirects"},
+		{Name: "forceIP", Args: map[string]string{"ip": "127.0.0.2"}},
+		{Name: "request", Args: map[string]string{"url": fmt.Sprintf("http://hidra.invalid:%d/", listener.Addr().(*net.TCPAddr).Port)}},
+		{Name: "finalURLShouldBe", Args: map[string]string{"url": targetURL}},
+		{Name: "bodyShouldContain", Args: map[string]string{"search": "target"}},
+	} {
+		if _, err := h.RunStep(ctx, previous, step); err != nil {
+			t.Fatalf("%s: %s", step.Name, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/utils"
+)
+
+// jsonPathValues returns the values of the response body matching a JSONPath expression.
+func jsonPathValues(stepsgen map[string]any, path string) ([]any, error) {
+	output, ok := stepsgen[misc.ContextOutput].([]byte)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	values, err := utils.JSONPathFromBytes(output, path)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %w", err)
+	}
+
+	return values, nil
+}
+
+// jsonPathValue returns the first value of the response body matching a JSONPath expression.
+func jsonPathValue(stepsgen map[string]any, path string) (any, error) {
+	values, err := jsonPathValues(stepsgen, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s not found in the response", path)
+	}
+
+	return values[0], nil
+}
+
+// jsonPathNumber returns the first value of the response body matching a JSONPath expression as a number.
+func jsonPathNumber(stepsgen map[string]any, path string) (float64, error) {
+	value, err := jsonPathValue(stepsgen, path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		number, err := v.Float64()
+		if err == nil {
+			return number, nil
+		}
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return number, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s is %s, expected a number", path, utils.JSONValueToString(value))
+}
+
+// jsonPathShouldExist checks if the response body has a value at the given JSONPath.
+func (p *HTTP) jsonPathShouldExist(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	_, err := jsonPathValue(stepsgen, args["path"])
+
+	return nil, err
+}
+
+// jsonPathShouldBe checks if the value at the given JSONPath is equal to the expected value.
+func (p *HTTP) jsonPathShouldBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := jsonPathValue(stepsgen, args["path"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	actual := utils.JSONValueToString(value)
+
+	if actual != args["value"] {
+		return nil, fmt.Errorf("expected %s to be %s, got %s", args["path"], args["value"], actual)
+	}
+
+	return nil, nil
+}
+
+// jsonPathShouldMatch checks if the value at the given JSONPath matches a regular expression.
+func (p *HTTP) jsonPathShouldMatch(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := jsonPathValue(stepsgen, args["path"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(args["regex"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	actual := utils.JSONValueToString(value)
+
+	if !re.MatchString(actual) {
+		return nil, fmt.Errorf("expected %s to match %s, got %s", args["path"], args["regex"], actual)
+	}
+
+	return nil, nil
+}
+
+// jsonPathShouldBeGreaterThan checks if the number at the given JSONPath is greater than the expected value.
+func (p *HTTP) jsonPathShouldBeGreaterThan(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	actual, expected, err := jsonPathNumbers(stepsgen, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if actual <= expected {
+		return nil, fmt.Errorf("expected %s to be greater than %v, got %v", args["path"], expected, actual)
+	}
+
+	return nil, nil
+}
+
+// jsonPathShouldBeLowerThan checks if the number at the given JSONPath is lower than the expected value.
+func (p *HTTP) jsonPathShouldBeLowerThan(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	actual, expected, err := jsonPathNumbers(stepsgen, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if actual >= expected {
+		return nil, fmt.Errorf("expected %s to be lower than %v, got %v", args["path"], expected, actual)
+	}
+
+	return nil, nil
+}
+
+// jsonPathNumbers returns the number at the JSONPath of the step and the expected value.
+func jsonPathNumbers(stepsgen map[string]any, args map[string]string) (float64, float64, error) {
+	expected, err := strconv.ParseFloat(args["value"], 64)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	actual, err := jsonPathNumber(stepsgen, args["path"])
+
+	return actual, expected, err
+}
+
+// jsonPathLengthShouldBe checks the length of the array at the given JSONPath. If the expression
+// matches several values, like $.items[*].id, the number of matches is checked instead.
+func (p *HTTP) jsonPathLengthShouldBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	expected, err := strconv.Atoi(args["length"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := jsonPathValues(stepsgen, args["path"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	length := len(values)
+
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case []any:
+			length = len(v)
+		case map[string]any:
+			length = len(v)
+		case string:
+			length = len(v)
+		}
+	}
+
+	if length != expected {
+		return nil, fmt.Errorf("expected %s to have length %d, got %d", args["path"], expected, length)
+	}
+
+	return nil, nil
+}
+
+// jsonPathToMetric exports the number at the given JSONPath as a metric.
+func (p *HTTP) jsonPathToMetric(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	value, err := jsonPathNumber(stepsgen, args["path"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	method, _ := stepsgen[misc.ContextHTTPMethod].(string)
+	url, _ := stepsgen[misc.ContextHTTPURL].(string)
+
+	return []*metrics.Metric{
+		{
+			Name:        "http_response_json_value",
+			Description: "A number extracted from the HTTP response body",
+			Value:       value,
+			Labels: map[string]string{
+				"name":   args["name"],
+				"method": method,
+				"url":    url,
+			},
+		},
+	}, nil
+}
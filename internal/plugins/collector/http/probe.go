@@ -0,0 +1,109 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// probeAddresses sends the request to each resolved address of the host, each one on a new connection,
+// and fails if a required family has no reachable address.
+func probeAddresses(ctx context.Context, client *http.Client, req *http.Request, body []byte, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	if args["requiredFamilies"] != "" {
+		if err := utils.ValidateFamilies(args["requiredFamilies"]); err != nil {
+			return nil, err
+		}
+	}
+
+	mode := args["probe"]
+
+	if mode == "" {
+		mode = utils.ProbeFamilies
+	}
+
+	ips, err := utils.ResolveProbeTargets(ctx, req.URL.Hostname(), mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+
+	if !ok {
+		return nil, fmt.Errorf("the HTTP client doesn't support probing")
+	}
+
+	transport = transport.Clone()
+	transport.DisableKeepAlives = true
+	defer transport.CloseIdleConnections()
+
+	probeClient := &http.Client{
+		CheckRedirect: client.CheckRedirect,
+		Timeout:       client.Timeout,
+		Transport:     transport,
+	}
+
+	customMetrics := []*metrics.Metric{}
+	reachable := map[string]bool{}
+	failures := []string{}
+
+	for _, ip := range ips {
+		family := utils.IPFamily(ip)
+
+		probeReq := req.Clone(withForcedIP(ctx, req.URL, ip.String()))
+		probeReq.Body = io.NopCloser(bytes.NewReader(body))
+
+		startTime := time.Now()
+		resp, err := probeClient.Do(probeReq)
+
+		if err == nil {
+			_, err = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		responseTime := time.Since(startTime).Seconds()
+		success := 0.0
+
+		if err == nil {
+			success = 1
+			reachable[family] = true
+		} else {
+			log.Debugf("Probe of %s through %s failed: %s", req.URL, ip, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", ip, err))
+		}
+
+		labels := map[string]string{
+			"method": stepsgen[misc.ContextHTTPMethod].(string),
+			"url":    stepsgen[misc.ContextHTTPURL].(string),
+			"ip":     ip.String(),
+			"family": family,
+		}
+
+		customMetrics = append(customMetrics, &metrics.Metric{
+			Name:        "http_probe_success",
+			Description: "1 if the HTTP request through the address succeeded, 0 otherwise",
+			Value:       success,
+			Labels:      labels,
+		}, &metrics.Metric{
+			Name:        "http_probe_response_time",
+			Description: "The HTTP response time through the address",
+			Value:       responseTime,
+			Labels:      labels,
+		})
+	}
+
+	if err := utils.CheckRequiredFamilies(args["requiredFamilies"], reachable); err != nil {
+		return customMetrics, fmt.Errorf("%s: %s", err, strings.Join(failures, "; "))
+	}
+
+	return customMetrics, nil
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+// maxFollowedRedirects is the number of redirects after which a request fails, like in the default
+// client of net/http.
+const maxFollowedRedirects = 10
+
+// redirectHop is a response of a redirect chain which redirected to another URL.
+type redirectHop struct {
+	URL        string
+	StatusCode int
+	Location   string
+	Duration   time.Duration
+	// Cookies are the cookies set by the redirect response.
+	Cookies []*http.Cookie
+}
+
+// redirectChain is the list of redirects followed by a request.
+type redirectChain struct {
+	hops     []redirectHop
+	hopStart time.Time
+}
+
+// newRedirectChain returns an empty chain for a request starting now.
+func newRedirectChain() *redirectChain {
+	return &redirectChain{
+		hops:     []redirectHop{},
+		hopStart: time.Now(),
+	}
+}
+
+// add records the redirect from the previous request to the next one.
+func (c *redirectChain) add(previous, next *http.Request) {
+	now := time.Now()
+
+	hop := redirectHop{
+		URL:      previous.URL.String(),
+		Location: next.URL.String(),
+		Duration: now.Sub(c.hopStart),
+	}
+
+	if next.Response != nil {
+		hop.StatusCode = next.Response.StatusCode
+		hop.Cookies = next.Response.Cookies()
+	}
+
+	c.hops = append(c.hops, hop)
+	c.hopStart = now
+}
+
+// duration returns the time spent in redirects.
+func (c *redirectChain) duration() time.Duration {
+	var total time.Duration
+
+	for _, hop := range c.hops {
+		total += hop.Duration
+	}
+
+	return total
+}
+
+// String returns a line per hop, to be attached to the report.
+func (c *redirectChain) String() string {
+	var sb strings.Builder
+
+	for _, hop := range c.hops {
+		fmt.Fprintf(&sb, "%d %s -> %s (%s)\n", hop.StatusCode, hop.URL, hop.Location, hop.Duration.Round(time.Millisecond))
+	}
+
+	return sb.String()
+}
+
+// checkRedirect follows the redirects only if the sample asked for it, recording them in the chain of
+// the request. Going back to a URL is allowed, as login flows do it after setting a cookie, so loops
+// are stopped by the redirects limit.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	// Get context from request
+	ctx := req.Context()
+
+	// Check if context has followRedirects
+	if _, ok := ctx.Value(misc.ContextHTTPFollowRedirects).(bool); !ok {
+		return http.ErrUseLastResponse
+	}
+
+	if chain, ok := ctx.Value(misc.ContextHTTPRedirects).(*redirectChain); ok {
+		chain.add(via[len(via)-1], req)
+	}
+
+	if len(via) >= maxFollowedRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxFollowedRedirects)
+	}
+
+	return nil
+}
+
+// redirectMetrics returns the number of redirects and the time spent in them.
+func redirectMetrics(chain *redirectChain, stepsgen map[string]any) []*metrics.Metric {
+	return []*metrics.Metric{
+		{
+			Name:        "http_response_redirects",
+			Description: "The number of redirects followed by the HTTP request",
+			Value:       float64(len(chain.hops)),
+			Labels: map[string]string{
+				"method": stepsgen[misc.ContextHTTPMethod].(string),
+				"url":    stepsgen[misc.ContextHTTPURL].(string),
+			},
+		},
+		{
+			Name:        "http_response_redirect_time",
+			Description: "The time spent in the redirects followed by the HTTP request",
+			Value:       chain.duration().Seconds(),
+			Labels: map[string]string{
+				"method": stepsgen[misc.ContextHTTPMethod].(string),
+				"url":    stepsgen[misc.ContextHTTPURL].(string),
+			},
+		},
+	}
+}
+
+// maxRedirects checks if the last request followed at most the given number of redirects.
+func (p *HTTP) maxRedirects(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	chain, ok := stepsgen[misc.ContextHTTPRedirects].(*redirectChain)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	max, err := strconv.Atoi(args["max"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chain.hops) > max {
+		return nil, fmt.Errorf("expected at most %d redirects, got %d:\n%s", max, len(chain.hops), chain)
+	}
+
+	return nil, nil
+}
+
+// shouldRedirectChainBe checks the URLs of the redirect chain of the last request.
+func (p *HTTP) shouldRedirectChainBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	chain, ok := stepsgen[misc.ContextHTTPRedirects].(*redirectChain)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	expected := []string{}
+
+	for _, u := range strings.Split(args["urls"], ",") {
+		expected = append(expected, strings.TrimSpace(u))
+	}
+
+	actual := []string{stepsgen[misc.ContextHTTPURL].(string)}
+
+	for _, hop := range chain.hops {
+		actual = append(actual, hop.Location)
+	}
+
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		return nil, fmt.Errorf("expected redirect chain %s, got %s", strings.Join(expected, " -> "), strings.Join(actual, " -> "))
+	}
+
+	return nil, nil
+}
+
+// finalURLShouldBe checks the URL of the last response, after the redirects.
+func (p *HTTP) finalURLShouldBe(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	resp, ok := stepsgen[misc.ContextHTTPResponse].(*http.Response)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	if finalURL := resp.Request.URL.String(); finalURL != args["url"] {
+		return nil, fmt.Errorf("expected final URL %s, got %s", args["url"], finalURL)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,490 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// documentKindSchema and documentKindOpenAPI are the kinds of documents the schemas are compiled
+	// from, as the same file is parsed differently as a JSON Schema and as an OpenAPI document.
+	documentKindSchema  = "schema"
+	documentKindOpenAPI = "openapi"
+)
+
+var (
+	// schemaCache keeps the compiled schemas until their file changes.
+	schemaCache = make(map[string]*cachedSchema)
+
+	// schemaCacheMutex guards schemaCache.
+	schemaCacheMutex sync.Mutex
+
+	// documentCache keeps the OpenAPI documents until their file changes.
+	documentCache = make(map[string]*cachedDocument)
+
+	// documentCacheMutex guards documentCache.
+	documentCacheMutex sync.Mutex
+
+	// schemaPrinter prints the schema violations.
+	schemaPrinter = message.NewPrinter(language.English)
+)
+
+// cachedSchema is a compiled schema and the modification time of its file.
+type cachedSchema struct {
+	modTime time.Time
+	schema  *jsonschema.Schema
+}
+
+// cachedDocument is a parsed document and the modification time of its file.
+type cachedDocument struct {
+	modTime time.Time
+	doc     any
+}
+
+// loadDocument reads a JSON or YAML document.
+func loadDocument(path string) (any, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if ext == ".yml" || ext == ".yaml" {
+		var doc any
+
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+
+		data, err = json.Marshal(normalizeYAML(doc))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jsonschema.UnmarshalJSON(bytes.NewReader(data))
+}
+
+// normalizeYAML converts the maps decoded from YAML to maps with string keys, like the
+// response codes of OpenAPI documents.
+func normalizeYAML(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = normalizeYAML(child)
+		}
+		return v
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, child := range v {
+			result[fmt.Sprint(key)] = normalizeYAML(child)
+		}
+		return result
+	case []any:
+		for i, child := range v {
+			v[i] = normalizeYAML(child)
+		}
+		return v
+	}
+
+	return value
+}
+
+// loadOpenAPIDocument reads an OpenAPI document, unless it's cached and its file didn't change.
+func loadOpenAPIDocument(path string) (any, error) {
+	absPath, err := filepath.Abs(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(absPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	documentCacheMutex.Lock()
+	defer documentCacheMutex.Unlock()
+
+	if cached, ok := documentCache[absPath]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.doc, nil
+	}
+
+	doc, err := loadDocument(absPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if root, ok := doc.(map[string]any); ok {
+		if version, _ := root["openapi"].(string); strings.HasPrefix(version, "3.0") {
+			translateNullable(doc)
+		}
+	}
+
+	documentCache[absPath] = &cachedDocument{
+		modTime: info.ModTime(),
+		doc:     doc,
+	}
+
+	return doc, nil
+}
+
+// translateNullable replaces the nullable keyword of OpenAPI 3.0, which JSON Schema doesn't have, by a
+// null type and a null value in the enum, if any.
+func translateNullable(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if nullable, _ := v["nullable"].(bool); nullable {
+			delete(v, "nullable")
+
+			switch t := v["type"].(type) {
+			case string:
+				v["type"] = []any{t, "null"}
+			case []any:
+				v["type"] = append(t, "null")
+			}
+
+			if enum, ok := v["enum"].([]any); ok {
+				v["enum"] = append(enum, nil)
+			}
+		}
+
+		for _, child := range v {
+			translateNullable(child)
+		}
+	case []any:
+		for _, child := range v {
+			translateNullable(child)
+		}
+	}
+}
+
+// compileSchema compiles the schema at a JSON pointer of a document of a kind. An empty pointer is the
+// whole document.
+func compileSchema(kind, path string, doc any, pointer string) (*jsonschema.Schema, error) {
+	absPath, err := filepath.Abs(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(absPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := kind + ":" + absPath + "#" + pointer
+
+	schemaCacheMutex.Lock()
+	defer schemaCacheMutex.Unlock()
+
+	if cached, ok := schemaCache[key]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.schema, nil
+	}
+
+	if doc == nil {
+		doc, err = loadDocument(absPath)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	location := "file://" + filepath.ToSlash(absPath)
+
+	compiler := jsonschema.NewCompiler()
+
+	if err := compiler.AddResource(location, doc); err != nil {
+		return nil, err
+	}
+
+	schema, err := compiler.Compile(location + "#" + pointer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schemaCache[key] = &cachedSchema{
+		modTime: info.ModTime(),
+		schema:  schema,
+	}
+
+	return schema, nil
+}
+
+// schemaViolations returns the leaf errors of a validation error.
+func schemaViolations(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		return []string{fmt.Sprintf("at '%s': %s", jsonPointer(err.InstanceLocation), err.ErrorKind.LocalizedString(schemaPrinter))}
+	}
+
+	violations := []string{}
+
+	for _, cause := range err.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+
+	return violations
+}
+
+// jsonPointer builds a JSON pointer from its tokens.
+func jsonPointer(tokens []string) string {
+	var sb strings.Builder
+
+	for _, token := range tokens {
+		sb.WriteByte('/')
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+
+	return sb.String()
+}
+
+// validateOutput validates the response body against a schema. Violations are attached to the report.
+func validateOutput(stepsgen map[string]any, schema *jsonschema.Schema) error {
+	output, ok := stepsgen[misc.ContextOutput].([]byte)
+
+	if !ok {
+		return errContextNotFound
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(output))
+
+	if err != nil {
+		return fmt.Errorf("invalid JSON response: %w", err)
+	}
+
+	err = schema.Validate(instance)
+
+	if err == nil {
+		return nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+
+	if !ok {
+		return err
+	}
+
+	violations := strings.Join(schemaViolations(validationErr), "\n")
+
+	if attachments, ok := stepsgen[misc.ContextAttachment].(map[string][]byte); ok {
+		attachments["schema-violations.txt"] = []byte(violations)
+	}
+
+	return fmt.Errorf("response doesn't match the schema:\n%s", violations)
+}
+
+// openAPIResponsePointer returns the JSON pointer of the response schema of an operation.
+func openAPIResponsePointer(doc any, method, rawURL string, statusCode int) (string, error) {
+	root, _ := doc.(map[string]any)
+	paths, _ := root["paths"].(map[string]any)
+
+	if paths == nil {
+		return "", fmt.Errorf("the OpenAPI document has no paths")
+	}
+
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	pathKey := matchOpenAPIPath(paths, openAPIRequestPaths(root, u.Path))
+
+	if pathKey == "" {
+		return "", fmt.Errorf("path %s not found in the OpenAPI document", u.Path)
+	}
+
+	method = strings.ToLower(method)
+	pathItem, _ := paths[pathKey].(map[string]any)
+	operation, _ := pathItem[method].(map[string]any)
+
+	if operation == nil {
+		return "", fmt.Errorf("operation %s %s not found in the OpenAPI document", strings.ToUpper(method), pathKey)
+	}
+
+	responses, _ := operation["responses"].(map[string]any)
+
+	code := ""
+
+	for _, candidate := range []string{strconv.Itoa(statusCode), fmt.Sprintf("%dXX", statusCode/100), "default"} {
+		if _, ok := responses[candidate]; ok {
+			code = candidate
+			break
+		}
+	}
+
+	if code == "" {
+		return "", fmt.Errorf("response %d of %s %s not found in the OpenAPI document", statusCode, strings.ToUpper(method), pathKey)
+	}
+
+	response, _ := responses[code].(map[string]any)
+	content, _ := response["content"].(map[string]any)
+
+	contentTypes := []string{}
+
+	for contentType, media := range content {
+		mediaType, _ := media.(map[string]any)
+
+		if schema, ok := mediaType["schema"]; ok && schema != nil && strings.Contains(contentType, "json") {
+			contentTypes = append(contentTypes, contentType)
+		}
+	}
+
+	if len(contentTypes) == 0 {
+		return "", fmt.Errorf("response %s of %s %s has no JSON schema", code, strings.ToUpper(method), pathKey)
+	}
+
+	sort.Strings(contentTypes)
+
+	contentType := contentTypes[0]
+
+	for _, candidate := range contentTypes {
+		if candidate == "application/json" {
+			contentType = candidate
+		}
+	}
+
+	tokens := []string{"paths", pathKey, method, "responses", code, "content", contentType, "schema"}
+	escaped := strings.Split(jsonPointer(tokens), "/")
+
+	for i := range escaped {
+		escaped[i] = url.PathEscape(escaped[i])
+	}
+
+	return strings.Join(escaped, "/"), nil
+}
+
+// openAPIRequestPaths returns the request path, and the request path without the base path of each server.
+func openAPIRequestPaths(root map[string]any, requestPath string) []string {
+	requestPaths := []string{requestPath}
+
+	servers, _ := root["servers"].([]any)
+
+	for _, server := range servers {
+		serverConfig, _ := server.(map[string]any)
+		serverURL, _ := serverConfig["url"].(string)
+		u, err := url.Parse(serverURL)
+
+		if err != nil || strings.Contains(serverURL, "{") {
+			continue
+		}
+
+		basePath := strings.TrimSuffix(u.Path, "/")
+
+		if basePath != "" && strings.HasPrefix(requestPath, basePath+"/") {
+			requestPaths = append(requestPaths, strings.TrimPrefix(requestPath, basePath))
+		}
+	}
+
+	return requestPaths
+}
+
+// matchOpenAPIPath returns the path of the document matching one of the request paths. Paths with less
+// templated segments win, so /users/me is preferred over /users/{id}.
+func matchOpenAPIPath(paths map[string]any, requestPaths []string) string {
+	best, bestTemplates := "", -1
+
+	for pathKey := range paths {
+		templateSegments := strings.Split(strings.Trim(pathKey, "/"), "/")
+
+		for _, requestPath := range requestPaths {
+			segments := strings.Split(strings.Trim(requestPath, "/"), "/")
+
+			if len(segments) != len(templateSegments) {
+				continue
+			}
+
+			templates := 0
+			match := true
+
+			for i, segment := range templateSegments {
+				if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+					templates++
+					continue
+				}
+
+				if segment != segments[i] {
+					match = false
+					break
+				}
+			}
+
+			if match && (bestTemplates == -1 || templates < bestTemplates || (templates == bestTemplates && pathKey < best)) {
+				best, bestTemplates = pathKey, templates
+			}
+		}
+	}
+
+	return best
+}
+
+// jsonSchemaShouldMatch validates the JSON response against a JSON Schema file.
+func (p *HTTP) jsonSchemaShouldMatch(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	schema, err := compileSchema(documentKindSchema, samplePath(stepsgen, args["schema"]), nil, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", args["schema"], err)
+	}
+
+	return nil, validateOutput(stepsgen, schema)
+}
+
+// openAPIShouldMatch validates the JSON response against the response schema of the operation of an
+// OpenAPI document matching the request method and URL.
+func (p *HTTP) openAPIShouldMatch(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	resp, ok := stepsgen[misc.ContextHTTPResponse].(*http.Response)
+
+	if !ok {
+		return nil, errContextNotFound
+	}
+
+	method, _ := stepsgen[misc.ContextHTTPMethod].(string)
+	rawURL, _ := stepsgen[misc.ContextHTTPURL].(string)
+
+	spec := samplePath(stepsgen, args["spec"])
+
+	doc, err := loadOpenAPIDocument(spec)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document %s: %w", args["spec"], err)
+	}
+
+	pointer, err := openAPIResponsePointer(doc, method, rawURL, resp.StatusCode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := compileSchema(documentKindOpenAPI, spec, doc, pointer)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document %s: %w", args["spec"], err)
+	}
+
+	return nil, validateOutput(stepsgen, schema)
+}
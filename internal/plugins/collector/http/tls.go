@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+)
+
+// newTLSConfig returns the TLS configuration of a client. The CA bundle is added to the system roots.
+func newTLSConfig(insecure bool, caFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure, // nolint:gosec
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// tlsVerificationFailureReason returns why the certificate of the server was rejected, or an empty string
+// if the error is not a certificate verification error.
+func tlsVerificationFailureReason(err error) string {
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var systemRootsErr x509.SystemRootsError
+	var verificationErr *tls.CertificateVerificationError
+
+	switch {
+	case errors.As(err, &invalidErr):
+		if invalidErr.Reason != x509.Expired {
+			return "invalid"
+		}
+
+		if invalidErr.Cert != nil && time.Now().Before(invalidErr.Cert.NotBefore) {
+			return "not_yet_valid"
+		}
+
+		return "expired"
+	case errors.As(err, &hostnameErr):
+		return "hostname_mismatch"
+	case errors.As(err, &unknownAuthorityErr), errors.As(err, &systemRootsErr):
+		return "unknown_authority"
+	case errors.As(err, &verificationErr):
+		return "other"
+	}
+
+	return ""
+}
+
+// tlsVerificationFailureMetrics returns the metric with the reason of a certificate verification failure.
+func tlsVerificationFailureMetrics(err error, stepsgen map[string]any) []*metrics.Metric {
+	reason := tlsVerificationFailureReason(err)
+
+	if reason == "" {
+		return nil
+	}
+
+	return []*metrics.Metric{
+		{
+			Name:        "http_tls_verification_failure",
+			Description: "The HTTP TLS certificate verification failure, by reason",
+			Value:       1,
+			Labels: map[string]string{
+				"method": stepsgen[misc.ContextHTTPMethod].(string),
+				"url":    stepsgen[misc.ContextHTTPURL].(string),
+				"reason": reason,
+			},
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// probeAddresses connects to each resolved address of the host, and fails if a required family has no
+// reachable address.
+func probeAddresses(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	if args["requiredFamilies"] != "" {
+		if err := utils.ValidateFamilies(args["requiredFamilies"]); err != nil {
+			return nil, err
+		}
+	}
+
+	host, port, err := net.SplitHostPort(args["to"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	mode := args["probe"]
+
+	if mode == "" {
+		mode = utils.ProbeFamilies
+	}
+
+	ips, err := utils.ResolveProbeTargets(ctx, host, mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 10 * time.Second
+
+	if stepTimeout, ok := stepsgen[misc.ContextTimeout].(time.Duration); ok {
+		timeout = stepTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	customMetrics := []*metrics.Metric{}
+	reachable := map[string]bool{}
+	failures := []string{}
+
+	for _, ip := range ips {
+		family := utils.IPFamily(ip)
+
+		startTime := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+		connectTime := time.Since(startTime).Seconds()
+
+		success := 0.0
+
+		if err == nil {
+			conn.Close()
+			success = 1
+			reachable[family] = true
+		} else {
+			log.Debugf("Probe of %s through %s failed: %s", args["to"], ip, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", ip, err))
+		}
+
+		labels := map[string]string{
+			"to":     args["to"],
+			"ip":     ip.String(),
+			"family": family,
+		}
+
+		customMetrics = append(customMetrics, &metrics.Metric{
+			Name:        "tcp_probe_success",
+			Description: "1 if the TCP connection to the address succeeded, 0 otherwise",
+			Value:       success,
+			Labels:      labels,
+		}, &metrics.Metric{
+			Name:        "tcp_probe_connect_time",
+			Description: "The time it took to connect to the address",
+			Value:       connectTime,
+			Labels:      labels,
+		})
+	}
+
+	if err := utils.CheckRequiredFamilies(args["requiredFamilies"], reachable); err != nil {
+		return customMetrics, fmt.Errorf("%s: %s", err, strings.Join(failures, "; "))
+	}
+
+	return customMetrics, nil
+}
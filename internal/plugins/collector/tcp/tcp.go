@@ -10,6 +10,7 @@ import (
 	"github.com/hidracloud/hidra/v3/internal/metrics"
 	"github.com/hidracloud/hidra/v3/internal/misc"
 	"github.com/hidracloud/hidra/v3/internal/plugins"
+	"github.com/hidracloud/hidra/v3/internal/utils"
 
 	b64 "encoding/base64"
 )
@@ -33,6 +34,10 @@ func (p *TCP) connectTo(ctx2 context.Context, args map[string]string, stepsgen m
 
 	stepsgen[misc.ContextTCPConnection] = conn
 
+	if args["probe"] != "" || args["requiredFamilies"] != "" {
+		return probeAddresses(ctx2, args, stepsgen)
+	}
+
 	return nil, nil
 }
 
@@ -148,8 +153,21 @@ func (p *TCP) Init() {
 			{
 				Name:        "to",
 				Description: "Host to connect to",
+				Type:        plugins.ParamTypeHostPort,
 				Optional:    false,
 			},
+			{
+				Name:          "probe",
+				Description:   "Also connects to the first address of each family, or to every address",
+				Type:          plugins.ParamTypeEnum,
+				AllowedValues: utils.ProbeModes,
+				Optional:      true,
+			},
+			{
+				Name:        "requiredFamilies",
+				Description: "The families which must be reachable when probing, like ipv4,ipv6",
+				Optional:    true,
+			},
 		},
 		Fn: p.connectTo,
 	})
@@ -174,6 +192,7 @@ func (p *TCP) Init() {
 			{
 				Name:        "bytesToRead",
 				Description: "Number of bytes to read",
+				Type:        plugins.ParamTypeInt,
 				Optional:    true,
 			},
 		},
@@ -2,8 +2,10 @@ package tcp_test
 
 import (
 	"context"
+	"net"
 	"testing"
 
+	"github.com/hidracloud/hidra/v3/internal/misc"
 	"github.com/hidracloud/hidra/v3/internal/plugins"
 	"github.com/hidracloud/hidra/v3/internal/plugins/collector/tcp"
 )
@@ -46,3 +48,53 @@ func TestScenario(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestProbe(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	h := &tcp.TCP{}
+	h.Init()
+
+	ctx := context.TODO()
+
+	for _, test := range []struct {
+		args    map[string]string
+		success bool
+	}{
+		{map[string]string{"probe": "families"}, true},
+		{map[string]string{"requiredFamilies": "ipv4"}, true},
+		{map[string]string{"requiredFamilies": "ipv4,ipv6"}, false},
+		{map[string]string{"requiredFamilies": "ipx"}, false},
+	} {
+		previous := map[string]any{}
+		test.args["to"] = listener.Addr().String()
+
+		stepMetrics, err := h.RunStep(ctx, previous, &plugins.Step{Name: "connectTo", Args: test.args})
+
+		if (err == nil) != test.success {
+			t.Errorf("%v: unexpected result %v", test.args, err)
+		}
+
+		if err == nil && (len(stepMetrics) != 2 || stepMetrics[0].Value != 1 || stepMetrics[0].Labels["family"] != "ipv4") {
+			t.Errorf("%v: unexpected metrics %v", test.args, stepMetrics)
+		}
+
+		if conn, ok := previous[misc.ContextTCPConnection].(net.Conn); ok {
+			conn.Close()
+		}
+	}
+}
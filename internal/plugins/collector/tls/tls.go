@@ -232,6 +232,7 @@ func (p *TLS) Init() {
 			{
 				Name:        "for",
 				Description: "Duration for which the certificate should be valid",
+				Type:        plugins.ParamTypeDuration,
 				Optional:    false,
 			},
 		},
@@ -148,6 +148,7 @@ func (p *UDP) Init() {
 			{
 				Name:        "to",
 				Description: "Host to connect to",
+				Type:        plugins.ParamTypeHostPort,
 				Optional:    false,
 			},
 		},
@@ -174,6 +175,7 @@ func (p *UDP) Init() {
 			{
 				Name:        "bytesToRead",
 				Description: "Number of bytes to read",
+				Type:        plugins.ParamTypeInt,
 				Optional:    true,
 			},
 		},
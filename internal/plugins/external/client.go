@@ -0,0 +1,271 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errPluginExited = errors.New("external plugin exited")
+
+	// stopGracePeriod is the time given to a plugin to exit after closing its stdin, before killing it.
+	stopGracePeriod = 5 * time.Second
+)
+
+// client talks JSON-RPC over stdio with an external plugin process.
+type client struct {
+	// path is the path to the plugin executable.
+	path string
+	// onRestart is called when the process is started again after exiting, before the call starting it.
+	// It must talk to the plugin with send, as the other calls wait for it to finish.
+	onRestart func(context.Context) error
+
+	// mutex protects all fields below.
+	mutex   sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	exited  chan struct{}
+	pending map[uint64]chan *response
+	nextID  uint64
+	started bool
+	// restarting is closed when onRestart finishes, nil if the process isn't being restarted.
+	restarting chan struct{}
+}
+
+// newClient creates a new client for the given executable.
+func newClient(path string) *client {
+	return &client{
+		path:    path,
+		pending: make(map[uint64]chan *response),
+	}
+}
+
+// start starts the plugin process. Must be called with the mutex held.
+func (c *client) start() error {
+	cmd := exec.Command(c.path)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	c.cmd = cmd
+	c.stdin = stdin
+	c.exited = make(chan struct{})
+
+	go c.readLoop(cmd, stdout, c.exited)
+	go c.logStderr(stderr)
+
+	log.Debugf("External plugin %s started with pid %d", c.path, cmd.Process.Pid)
+
+	return nil
+}
+
+// readLoop dispatches responses to the pending calls until the process exits, then closes exited.
+func (c *client) readLoop(cmd *exec.Cmd, stdout io.Reader, exited chan struct{}) {
+	defer close(exited)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		var resp response
+
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			log.Warnf("External plugin %s sent an invalid response: %s", c.path, err)
+			continue
+		}
+
+		c.mutex.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mutex.Unlock()
+
+		if ok {
+			ch <- &resp
+		}
+	}
+
+	err := cmd.Wait()
+	log.Warnf("External plugin %s exited: %v", c.path, err)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cmd == cmd {
+		c.cmd = nil
+		c.stdin = nil
+	}
+
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+// logStderr forwards the plugin stderr to the debug log.
+func (c *client) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+
+	for scanner.Scan() {
+		log.Debugf("[%s] %s", c.path, scanner.Text())
+	}
+}
+
+// call invokes a method on the plugin and decodes the result into result. The process is started
+// again if it exited, and the call waits until the restarted plugin has been described.
+func (c *client) call(ctx context.Context, method string, params, result any) error {
+	c.mutex.Lock()
+
+	for c.restarting != nil {
+		restarting := c.restarting
+		c.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-restarting:
+		}
+
+		c.mutex.Lock()
+	}
+
+	if c.cmd == nil {
+		restarted := c.started
+
+		if err := c.start(); err != nil {
+			c.mutex.Unlock()
+			return fmt.Errorf("error starting external plugin %s: %w", c.path, err)
+		}
+
+		c.started = true
+
+		if restarted && c.onRestart != nil {
+			restarting := make(chan struct{})
+			c.restarting = restarting
+			c.mutex.Unlock()
+
+			err := c.onRestart(ctx)
+
+			c.mutex.Lock()
+			c.restarting = nil
+			close(restarting)
+
+			if err != nil {
+				c.mutex.Unlock()
+				return fmt.Errorf("error describing restarted external plugin %s: %w", c.path, err)
+			}
+		}
+	}
+
+	return c.sendLocked(ctx, method, params, result)
+}
+
+// send invokes a method on the running plugin and decodes the result into result, without starting
+// the process again.
+func (c *client) send(ctx context.Context, method string, params, result any) error {
+	c.mutex.Lock()
+
+	return c.sendLocked(ctx, method, params, result)
+}
+
+// sendLocked is send with the mutex held, which it releases.
+func (c *client) sendLocked(ctx context.Context, method string, params, result any) error {
+	if c.cmd == nil {
+		c.mutex.Unlock()
+		return errPluginExited
+	}
+
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *response, 1)
+	c.pending[id] = ch
+
+	b, err := json.Marshal(&request{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	})
+
+	if err == nil {
+		_, err = c.stdin.Write(append(b, '\n'))
+	}
+
+	if err != nil {
+		delete(c.pending, id)
+		c.mutex.Unlock()
+		return err
+	}
+
+	c.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+
+		return ctx.Err()
+	case resp, ok := <-ch:
+		if !ok {
+			return errPluginExited
+		}
+
+		if resp.Error != nil {
+			return resp.Error
+		}
+
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+// stop stops the plugin process. Closing stdin lets well behaved plugins exit by themselves, and
+// the process is killed if it is still running after stopGracePeriod.
+func (c *client) stop() {
+	c.mutex.Lock()
+
+	if c.cmd == nil {
+		c.mutex.Unlock()
+		return
+	}
+
+	cmd, exited := c.cmd, c.exited
+	_ = c.stdin.Close()
+
+	c.mutex.Unlock()
+
+	select {
+	case <-exited:
+	case <-time.After(stopGracePeriod):
+		log.Warnf("External plugin %s didn't exit after closing its stdin, killing it", c.path)
+		_ = cmd.Process.Kill()
+	}
+}
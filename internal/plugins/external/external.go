@@ -0,0 +1,266 @@
+// Package external loads plugins that run out of process and speak
+// JSON-RPC 2.0 over stdio, so collectors can be shipped without
+// recompiling hidra.
+//
+// Every executable found in the plugins directory is started once and asked
+// to "describe" itself, again if its process has to be restarted. Then, every step is forwarded with "runStep" and, when
+// a sample run finishes, "close" lets the plugin release its session state.
+// Messages are newline delimited JSON objects.
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// describeTimeout is the time given to a plugin to describe itself.
+	describeTimeout = 10 * time.Second
+
+	// sessionCounter is used to generate session ids.
+	sessionCounter atomic.Uint64
+
+	// loaded are the plugins loaded from disk.
+	loaded []*External
+)
+
+// External represents a plugin running out of process.
+type External struct {
+	plugins.BasePlugin
+
+	// Name is the name advertised by the plugin.
+	Name string
+	// Description is the description advertised by the plugin.
+	Description string
+
+	client *client
+
+	// mutex protects the step definitions, which are replaced when the plugin is described again.
+	mutex sync.RWMutex
+}
+
+// New creates a new external plugin from an executable path.
+func New(path string) *External {
+	p := &External{
+		client: newClient(path),
+	}
+
+	p.client.onRestart = func(ctx context.Context) error {
+		return p.describe(ctx, p.client.send)
+	}
+
+	return p
+}
+
+// Init initializes the plugin.
+func (p *External) Init() {
+	p.Primitives()
+}
+
+// Load starts the plugin and registers the steps it advertises.
+func (p *External) Load(ctx context.Context) error {
+	p.Init()
+
+	return p.describe(ctx, p.client.call)
+}
+
+// describe asks the plugin for its name and steps, replacing the steps registered before. It runs
+// when the plugin is loaded and every time its process is started again, as the executable may have
+// changed since. Call is the method of the client used to talk to the plugin.
+func (p *External) describe(ctx context.Context, call func(context.Context, string, any, any) error) error {
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+
+	var desc describeResult
+
+	if err := call(ctx, methodDescribe, nil, &desc); err != nil {
+		return err
+	}
+
+	if desc.Name == "" {
+		return errors.New("plugin didn't advertise a name")
+	}
+
+	steps := plugins.BasePlugin{}
+	steps.Primitives()
+
+	for _, step := range desc.Steps {
+		if step == nil || step.Name == "" {
+			continue
+		}
+
+		step.Fn = p.forward(step.Name)
+		steps.RegisterStep(step)
+	}
+
+	steps.RegisterStep(&plugins.StepDefinition{
+		Name:        "onClose",
+		Description: "Releases the state kept by the plugin for the current run",
+		Fn:          p.onClose,
+	})
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.Name != "" && p.Name != desc.Name {
+		return fmt.Errorf("plugin %s advertised the name %s after restarting", p.Name, desc.Name)
+	}
+
+	p.Name = desc.Name
+	p.Description = desc.Description
+	p.StepDefinitions = steps.StepDefinitions
+
+	return nil
+}
+
+// steps returns the plugin with the step definitions currently registered.
+func (p *External) steps() *plugins.BasePlugin {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return &plugins.BasePlugin{StepDefinitions: p.StepDefinitions}
+}
+
+// RunStep runs a step.
+func (p *External) RunStep(ctx context.Context, stepsgen map[string]any, step *plugins.Step) ([]*metrics.Metric, error) {
+	return p.steps().RunStep(ctx, stepsgen, step)
+}
+
+// StepExists returns true if the step exists.
+func (p *External) StepExists(name string) bool {
+	return p.steps().StepExists(name)
+}
+
+// GetSteps returns all steps.
+func (p *External) GetSteps() map[string]*plugins.StepDefinition {
+	return p.steps().GetSteps()
+}
+
+// Stop stops the plugin process.
+func (p *External) Stop() {
+	p.client.stop()
+}
+
+// forward returns a step function which runs the step inside the plugin.
+func (p *External) forward(name string) func(context.Context, map[string]string, map[string]any) ([]*metrics.Metric, error) {
+	return func(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+		params := &runStepParams{
+			Session: session(stepsgen),
+			Step:    name,
+			Args:    args,
+		}
+
+		if timeout, ok := stepsgen[misc.ContextTimeout].(time.Duration); ok {
+			params.TimeoutMs = timeout.Milliseconds()
+
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if output, ok := stepsgen[misc.ContextOutput].([]byte); ok {
+			params.Output = output
+		}
+
+		var result runStepResult
+
+		if err := p.client.call(ctx, methodRunStep, params, &result); err != nil {
+			return nil, err
+		}
+
+		if result.Output != nil {
+			stepsgen[misc.ContextOutput] = result.Output
+		}
+
+		customMetrics := toMetrics(result.Metrics)
+
+		if result.Error != "" {
+			return customMetrics, errors.New(result.Error)
+		}
+
+		return customMetrics, nil
+	}
+}
+
+// onClose releases the session kept by the plugin.
+func (p *External) onClose(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+	id, ok := stepsgen[misc.ContextExternalSession].(string)
+
+	if !ok {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	return nil, p.client.call(ctx, methodClose, &closeParams{Session: id}, nil)
+}
+
+// session returns the session id of the current run, creating it if needed.
+func session(stepsgen map[string]any) string {
+	if id, ok := stepsgen[misc.ContextExternalSession].(string); ok {
+		return id
+	}
+
+	id := strconv.FormatUint(sessionCounter.Add(1), 10)
+	stepsgen[misc.ContextExternalSession] = id
+
+	return id
+}
+
+// LoadPlugins discovers all executables inside path and registers them as plugins.
+func LoadPlugins(path string) error {
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		info, err := f.Info()
+
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		pluginPath := filepath.Join(path, f.Name())
+		p := New(pluginPath)
+
+		if err := p.Load(context.Background()); err != nil {
+			log.Errorf("Error loading external plugin %s: %s", pluginPath, err)
+			p.client.stop()
+			continue
+		}
+
+		if plugins.GetPlugin(p.Name) != nil {
+			log.Errorf("Error loading external plugin %s: %s", pluginPath, fmt.Errorf("plugin %s already exists", p.Name))
+			p.client.stop()
+			continue
+		}
+
+		log.Debugf("External plugin %s loaded from %s", p.Name, pluginPath)
+
+		plugins.AddPlugin(p.Name, p.Description, p)
+		loaded = append(loaded, p)
+	}
+
+	return nil
+}
+
+// StopPlugins stops all loaded plugins.
+func StopPlugins() {
+	for _, p := range loaded {
+		p.Stop()
+	}
+}
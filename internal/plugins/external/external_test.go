@@ -0,0 +1,352 @@
+package external_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+	"github.com/hidracloud/hidra/v3/internal/plugins/external"
+)
+
+// TestMain lets the test binary act as an external plugin.
+func TestMain(m *testing.M) {
+	if os.Getenv("HIDRA_EXTERNAL_PLUGIN_TEST") == "1" {
+		servePlugin()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// servePlugin implements a minimal external plugin. The methods answered are appended to the file of
+// HIDRA_EXTERNAL_PLUGIN_LOG, and the file of HIDRA_EXTERNAL_PLUGIN_EXITED is written when stdin is
+// closed.
+func servePlugin() {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	var mutex sync.Mutex
+
+	reply := func(id uint64, method string, result any) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if f, err := os.OpenFile(os.Getenv("HIDRA_EXTERNAL_PLUGIN_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err == nil {
+			fmt.Fprintln(f, method)
+			f.Close()
+		}
+
+		b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+		fmt.Println(string(b))
+	}
+
+	for scanner.Scan() {
+		var req struct {
+			ID     uint64 `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Step string            `json:"step"`
+				Args map[string]string `json:"args"`
+			} `json:"params"`
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+
+		var result any
+
+		switch req.Method {
+		case "describe":
+			steps := []map[string]any{
+				{
+					"name":        "echo",
+					"description": "Echoes the text",
+					"params": []map[string]any{
+						{"name": "text", "description": "The text", "optional": false},
+					},
+				},
+			}
+
+			// the steps named in the file of HIDRA_EXTERNAL_PLUGIN_STEPS are advertised too
+			if extra, err := os.ReadFile(os.Getenv("HIDRA_EXTERNAL_PLUGIN_STEPS")); err == nil {
+				steps = append(steps, map[string]any{"name": string(extra), "description": "Extra step"})
+			}
+
+			result = map[string]any{
+				"name":        "echo",
+				"description": "Echo plugin",
+				"steps":       steps,
+			}
+
+			// a slow plugin describes itself while answering the next requests
+			if os.Getenv("HIDRA_EXTERNAL_PLUGIN_SLOW") == "1" {
+				go func(id uint64) {
+					time.Sleep(200 * time.Millisecond)
+					reply(id, req.Method, result)
+				}(req.ID)
+
+				continue
+			}
+		case "runStep":
+			if req.Params.Args["text"] == "crash" {
+				os.Exit(1)
+			}
+
+			if req.Params.Args["text"] == "fail" {
+				result = map[string]any{"error": "asked to fail"}
+				break
+			}
+
+			result = map[string]any{
+				"output":  []byte(req.Params.Args["text"]),
+				"metrics": []map[string]any{{"name": "echo_length", "value": len(req.Params.Args["text"])}},
+			}
+		default:
+			result = map[string]any{}
+		}
+
+		reply(req.ID, req.Method, result)
+	}
+
+	if exited := os.Getenv("HIDRA_EXTERNAL_PLUGIN_EXITED"); exited != "" {
+		_ = os.WriteFile(exited, []byte("exited"), 0o644)
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "echo")
+
+	err = os.WriteFile(script, []byte("#!/bin/sh\nHIDRA_EXTERNAL_PLUGIN_TEST=1 exec "+self+"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = external.LoadPlugins(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer external.StopPlugins()
+
+	h := plugins.GetPlugin("echo")
+	if h == nil {
+		t.Fatal("expected echo plugin to be registered")
+	}
+
+	ctx := context.TODO()
+	previous := make(map[string]any, 0)
+
+	m, err := h.RunStep(ctx, previous, &plugins.Step{
+		Name: "echo",
+		Args: map[string]string{"text": "hello"},
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(m) != 1 || m[0].Name != "echo_length" || m[0].Value != 5 {
+		t.Errorf("unexpected metrics %v", m)
+	}
+
+	if string(previous[misc.ContextOutput].([]byte)) != "hello" {
+		t.Errorf("unexpected output %v", previous[misc.ContextOutput])
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{
+		Name: "echo",
+		Args: map[string]string{},
+	})
+
+	if err == nil {
+		t.Error("expected missing argument error")
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{
+		Name: "echo",
+		Args: map[string]string{"text": "fail"},
+	})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+
+	_, err = h.RunStep(ctx, previous, &plugins.Step{
+		Name: "onClose",
+		Args: map[string]string{},
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "echo")
+	steps := filepath.Join(dir, "steps")
+
+	err = os.WriteFile(script, []byte("#!/bin/sh\nHIDRA_EXTERNAL_PLUGIN_TEST=1 HIDRA_EXTERNAL_PLUGIN_STEPS="+steps+" exec "+self+"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := external.New(script)
+
+	if err := p.Load(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Stop()
+
+	if p.StepExists("shout") {
+		t.Fatal("unexpected shout step")
+	}
+
+	ctx := context.TODO()
+	previous := make(map[string]any, 0)
+
+	_, err = p.RunStep(ctx, previous, &plugins.Step{
+		Name: "echo",
+		Args: map[string]string{"text": "crash"},
+	})
+
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// the new process advertises one more step
+	if err := os.WriteFile(steps, []byte("shout"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.RunStep(ctx, previous, &plugins.Step{
+		Name: "echo",
+		Args: map[string]string{"text": "hello"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.StepExists("shout") || !p.StepExists("echo") || !p.StepExists("onClose") {
+		t.Errorf("expected the steps of the restarted plugin, got %v", p.GetSteps())
+	}
+}
+
+func TestRestartWaitsForDescribe(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "echo")
+	methods := filepath.Join(dir, "methods")
+
+	err = os.WriteFile(script, []byte("#!/bin/sh\nHIDRA_EXTERNAL_PLUGIN_TEST=1 HIDRA_EXTERNAL_PLUGIN_SLOW=1 HIDRA_EXTERNAL_PLUGIN_LOG="+methods+" exec "+self+"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := external.New(script)
+
+	if err := p.Load(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Stop()
+
+	_, err = p.RunStep(context.TODO(), map[string]any{}, &plugins.Step{
+		Name: "echo",
+		Args: map[string]string{"text": "crash"},
+	})
+
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// the second call arrives while the restarted plugin is describing itself
+	var wg sync.WaitGroup
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := p.RunStep(context.TODO(), map[string]any{}, &plugins.Step{
+				Name: "echo",
+				Args: map[string]string{"text": "hello"},
+			})
+
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	wg.Wait()
+
+	b, err := os.ReadFile(methods)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "describe,describe,runStep,runStep"
+
+	if got := strings.Join(strings.Fields(string(b)), ","); got != expected {
+		t.Errorf("expected the methods %s, got %s", expected, got)
+	}
+}
+
+func TestStop(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "echo")
+	exited := filepath.Join(dir, "exited")
+
+	err = os.WriteFile(script, []byte("#!/bin/sh\nHIDRA_EXTERNAL_PLUGIN_TEST=1 HIDRA_EXTERNAL_PLUGIN_EXITED="+exited+" exec "+self+"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := external.New(script)
+
+	if err := p.Load(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Stop()
+
+	// the plugin had the time to exit by itself
+	if _, err := os.Stat(exited); err != nil {
+		t.Errorf("expected the plugin to exit gracefully: %s", err)
+	}
+}
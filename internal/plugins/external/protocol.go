@@ -0,0 +1,121 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+)
+
+const (
+	// jsonRPCVersion is the JSON-RPC version spoken with external plugins.
+	jsonRPCVersion = "2.0"
+
+	// methodDescribe asks the plugin for its name, description and steps.
+	methodDescribe = "describe"
+	// methodRunStep runs one step inside the plugin.
+	methodRunStep = "runStep"
+	// methodClose releases the state kept by the plugin for a session.
+	methodClose = "close"
+)
+
+// request represents a JSON-RPC request sent to an external plugin.
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// response represents a JSON-RPC response received from an external plugin.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError represents a JSON-RPC error.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// describeResult is the result of the describe method.
+type describeResult struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Steps       []*plugins.StepDefinition `json:"steps"`
+}
+
+// runStepParams are the params of the runStep method.
+type runStepParams struct {
+	// Session identifies the sample run the step belongs to.
+	Session string `json:"session"`
+	// Step is the name of the step.
+	Step string `json:"step"`
+	// Args is the arguments of the step.
+	Args map[string]string `json:"args"`
+	// TimeoutMs is the timeout of the step in milliseconds.
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
+	// Output is the output left by the previous step, base64 encoded.
+	Output []byte `json:"output,omitempty"`
+}
+
+// runStepResult is the result of the runStep method.
+type runStepResult struct {
+	// Metrics is the metrics generated by the step.
+	Metrics []*metric `json:"metrics,omitempty"`
+	// Output is the new output of the step, base64 encoded.
+	Output []byte `json:"output,omitempty"`
+	// Error is the error of the step, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// closeParams are the params of the close method.
+type closeParams struct {
+	Session string `json:"session"`
+}
+
+// metric represents a metric on the wire.
+type metric struct {
+	Name        string            `json:"name"`
+	Value       float64           `json:"value"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Purge       bool              `json:"purge,omitempty"`
+	PurgeLabels []string          `json:"purgeLabels,omitempty"`
+}
+
+// toMetrics converts wire metrics to hidra metrics.
+func toMetrics(wire []*metric) []*metrics.Metric {
+	result := make([]*metrics.Metric, 0, len(wire))
+
+	for _, m := range wire {
+		if m == nil {
+			continue
+		}
+
+		labels := m.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		result = append(result, &metrics.Metric{
+			Name:        m.Name,
+			Value:       m.Value,
+			Labels:      labels,
+			Description: m.Description,
+			Purge:       m.Purge,
+			PurgeLabels: m.PurgeLabels,
+		})
+	}
+
+	return result
+}
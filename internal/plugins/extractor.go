@@ -0,0 +1,104 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/utils"
+)
+
+// ExtractorFn extracts a value from the state left by the previous steps.
+type ExtractorFn func(ctx context.Context, expression string, stepsgen map[string]any) (string, error)
+
+var (
+	extractors = make(map[string]ExtractorFn)
+)
+
+// AddExtractor adds an extractor.
+func AddExtractor(name string, fn ExtractorFn) {
+	extractors[name] = fn
+}
+
+// GetExtractor returns an extractor.
+func GetExtractor(name string) ExtractorFn {
+	return extractors[name]
+}
+
+// outputFromContext returns the output left by the previous steps.
+func outputFromContext(stepsgen map[string]any) ([]byte, error) {
+	output, ok := stepsgen[misc.ContextOutput].([]byte)
+
+	if !ok {
+		return nil, fmt.Errorf("output not found")
+	}
+
+	return output, nil
+}
+
+// extractOutput returns the whole output.
+func extractOutput(ctx context.Context, expression string, stepsgen map[string]any) (string, error) {
+	output, err := outputFromContext(stepsgen)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// extractRegex returns the first capturing group, or the whole match if there are no groups.
+func extractRegex(ctx context.Context, expression string, stepsgen map[string]any) (string, error) {
+	output, err := outputFromContext(stepsgen)
+
+	if err != nil {
+		return "", err
+	}
+
+	re, err := regexp.Compile(expression)
+
+	if err != nil {
+		return "", err
+	}
+
+	match := re.FindSubmatch(output)
+
+	if match == nil {
+		return "", fmt.Errorf("regex %s doesn't match the output", expression)
+	}
+
+	if len(match) > 1 {
+		return string(match[1]), nil
+	}
+
+	return string(match[0]), nil
+}
+
+// extractJSONPath returns the first value matching a JSONPath expression.
+func extractJSONPath(ctx context.Context, expression string, stepsgen map[string]any) (string, error) {
+	output, err := outputFromContext(stepsgen)
+
+	if err != nil {
+		return "", err
+	}
+
+	values, err := utils.JSONPathFromBytes(output, expression)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(values) == 0 {
+		return "", fmt.Errorf("JSONPath %s doesn't match the output", expression)
+	}
+
+	return utils.JSONValueToString(values[0]), nil
+}
+
+// init registers the extractors working on the output of any plugin.
+func init() {
+	AddExtractor("output", extractOutput)
+	AddExtractor("regex", extractRegex)
+	AddExtractor("jsonpath", extractJSONPath)
+}
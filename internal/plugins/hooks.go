@@ -0,0 +1,28 @@
+package plugins
+
+import "slices"
+
+const (
+	// HookOnStart runs before the first step of a plugin in a sample run.
+	HookOnStart = "onStart"
+	// HookBeforeEach runs before every step of a plugin.
+	HookBeforeEach = "beforeEach"
+	// HookAfterEach runs after every step of a plugin, even if the step failed.
+	HookAfterEach = "afterEach"
+	// HookOnSuccess runs when a sample run finishes without errors.
+	HookOnSuccess = "onSuccess"
+	// HookOnFailure runs when a step of a plugin fails.
+	HookOnFailure = "onFailure"
+	// HookOnClose runs when a sample run finishes.
+	HookOnClose = "onClose"
+)
+
+var (
+	// Hooks are the steps run by Hidra instead of by the samples.
+	Hooks = []string{HookOnStart, HookBeforeEach, HookAfterEach, HookOnSuccess, HookOnFailure, HookOnClose}
+)
+
+// IsHook returns true if the step is a hook.
+func IsHook(name string) bool {
+	return slices.Contains(Hooks, name)
+}
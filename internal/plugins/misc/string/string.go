@@ -70,6 +70,7 @@ func (p *Strings) Init() {
 			{
 				Name:        "times",
 				Description: "The number of times the string should appear",
+				Type:        plugins.ParamTypeInt,
 				Optional:    true,
 			},
 		},
@@ -0,0 +1,181 @@
+package plugins
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hidracloud/hidra/v3/internal/utils"
+)
+
+// ParamType represents the type of a step parameter.
+type ParamType string
+
+const (
+	// ParamTypeString is a free text parameter. It is the default type.
+	ParamTypeString ParamType = "string"
+	// ParamTypeInt is an integer parameter.
+	ParamTypeInt ParamType = "int"
+	// ParamTypeFloat is a floating point parameter.
+	ParamTypeFloat ParamType = "float"
+	// ParamTypeBool is a boolean parameter.
+	ParamTypeBool ParamType = "bool"
+	// ParamTypeDuration is a duration parameter, like 10s or 7d.
+	ParamTypeDuration ParamType = "duration"
+	// ParamTypeEnum is a parameter which must be one of AllowedValues.
+	ParamTypeEnum ParamType = "enum"
+	// ParamTypeRegex is a regular expression parameter.
+	ParamTypeRegex ParamType = "regex"
+	// ParamTypeURL is an absolute URL parameter.
+	ParamTypeURL ParamType = "url"
+	// ParamTypeHostPort is a host:port parameter.
+	ParamTypeHostPort ParamType = "hostport"
+	// ParamTypeJSONPath is a JSONPath expression, like $.items[0].name.
+	ParamTypeJSONPath ParamType = "jsonpath"
+)
+
+// isTemplate returns true if the value is a template which can only be checked at run time.
+func isTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// Validate checks if the value is valid for the parameter.
+func (p *StepParam) Validate(value string) error {
+	if isTemplate(value) {
+		return nil
+	}
+
+	var err error
+
+	switch p.Type {
+	case ParamTypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamTypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamTypeBool:
+		_, err = strconv.ParseBool(value)
+	case ParamTypeDuration:
+		_, err = utils.ParseDuration(value)
+	case ParamTypeRegex:
+		_, err = regexp.Compile(value)
+	case ParamTypeURL:
+		var u *url.URL
+		u, err = url.Parse(value)
+		if err == nil && (u.Scheme == "" || u.Host == "") {
+			err = fmt.Errorf("%s is not an absolute URL", value)
+		}
+	case ParamTypeJSONPath:
+		err = utils.ValidateJSONPath(value)
+	case ParamTypeHostPort:
+		var port string
+		_, port, err = net.SplitHostPort(value)
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q for argument %s: %w", p.Type, value, p.Name, err)
+	}
+
+	if len(p.AllowedValues) > 0 {
+		for _, allowed := range p.AllowedValues {
+			if strings.EqualFold(allowed, value) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("invalid value %q for argument %s, allowed values are %s", value, p.Name, strings.Join(p.AllowedValues, ", "))
+	}
+
+	return nil
+}
+
+// NormalizeArgs replaces the values of the arguments with allowed values by the allowed value they
+// match, as they are compared ignoring case, so the steps only have to handle the allowed values.
+func (s *StepDefinition) NormalizeArgs(args map[string]string) {
+	for _, param := range s.Params {
+		value, ok := args[param.Name]
+
+		if !ok {
+			continue
+		}
+
+		for _, allowed := range param.AllowedValues {
+			if strings.EqualFold(allowed, value) {
+				args[param.Name] = allowed
+				break
+			}
+		}
+	}
+}
+
+// ApplyDefaults sets the default value of every missing argument.
+func (s *StepDefinition) ApplyDefaults(args map[string]string) {
+	for _, param := range s.Params {
+		if _, ok := args[param.Name]; !ok && param.Default != "" {
+			args[param.Name] = param.Default
+		}
+	}
+}
+
+// Validate checks the arguments against the step definition and returns all problems found.
+// Unknown arguments are reported only when strict is true.
+func (s *StepDefinition) Validate(args map[string]string, strict bool) []error {
+	errs := []error{}
+	known := make(map[string]bool, len(s.Params))
+
+	for i := range s.Params {
+		param := &s.Params[i]
+		known[param.Name] = true
+
+		value, ok := args[param.Name]
+
+		if !ok {
+			if !param.Optional && param.Default == "" {
+				errs = append(errs, fmt.Errorf("missing argument %s", param.Name))
+			}
+			continue
+		}
+
+		if err := param.Validate(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if strict {
+		unknown := []string{}
+
+		for name := range args {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+
+		sort.Strings(unknown)
+
+		for _, name := range unknown {
+			errs = append(errs, fmt.Errorf("unknown argument %s for action %s", name, s.Name))
+		}
+	}
+
+	return errs
+}
+
+// MaskSecrets returns a copy of the arguments with the values of the secret parameters hidden, to be logged.
+func (s *StepDefinition) MaskSecrets(args map[string]string) map[string]string {
+	masked := maps.Clone(args)
+
+	for _, param := range s.Params {
+		if _, ok := masked[param.Name]; ok && param.Secret {
+			masked[param.Name] = "******"
+		}
+	}
+
+	return masked
+}
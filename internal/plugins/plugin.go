@@ -2,6 +2,7 @@ package plugins
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -38,6 +39,9 @@ type Step struct {
 	Negate bool
 	// IgnoreOnError is true if the step should ignore errors.
 	IgnoreOnError bool `default:"false"`
+	// SkipOnFailure is true if the onFailure hook shouldn't run when the step fails, like when the step
+	// will be retried.
+	SkipOnFailure bool
 }
 
 type stepFn func(context.Context, map[string]string, map[string]any) ([]*metrics.Metric, error)
@@ -47,6 +51,14 @@ type StepParam struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Optional    bool   `json:"optional"`
+	// Type is the type of the parameter, string if empty.
+	Type ParamType `json:"type,omitempty"`
+	// Default is the value used when the parameter is not given.
+	Default string `json:"default,omitempty"`
+	// AllowedValues restricts the values accepted by the parameter.
+	AllowedValues []string `json:"allowedValues,omitempty"`
+	// Secret hides the value of the parameter in the logs.
+	Secret bool `json:"secret,omitempty"`
 }
 
 // StepDefinition represents a step definition.
@@ -73,22 +85,32 @@ func (p *BasePlugin) RunStep(ctx context.Context, stepsgen map[string]any, step
 	// get step definition
 	stepDefinition, ok := p.StepDefinitions[step.Name]
 
-	if !ok && (step.Name == "onFailure" ||
-		step.Name == "onClose") {
+	if !ok && (step.Name == HookOnFailure ||
+		step.Name == HookOnClose) {
 		return nil, stepsgen[misc.ContextLastError].(error)
 	}
 
+	if !ok && IsHook(step.Name) {
+		return nil, nil
+	}
+
 	if !ok {
 		return nil, fmt.Errorf("step %s not found", step.Name)
 	}
 
+	if step.Args == nil {
+		step.Args = map[string]string{}
+	}
+
 	// validate step arguments
-	for _, param := range stepDefinition.Params {
-		if _, ok := step.Args[param.Name]; !ok && !param.Optional {
-			return nil, fmt.Errorf("missing argument %s", param.Name)
-		}
+	stepDefinition.ApplyDefaults(step.Args)
+
+	if errs := stepDefinition.Validate(step.Args, false); len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
+	stepDefinition.NormalizeArgs(step.Args)
+
 	if step.Timeout > 0 {
 		stepsgen[misc.ContextTimeout] = step.Timeout
 	}
@@ -103,14 +125,18 @@ func (p *BasePlugin) RunStep(ctx context.Context, stepsgen map[string]any, step
 			return metrics, fmt.Errorf("step %s should have failed", step.Name)
 		}
 
-		if err != nil && (step.Name != "onFailure" &&
-			step.Name != "onClose") {
+		if err != nil && !IsHook(step.Name) {
 			stepsgen[misc.ContextLastError] = err
-			step.Name = "onFailure"
 
-			metrics, _ = p.RunStep(ctx, stepsgen, step)
+			if step.SkipOnFailure {
+				return metrics, err
+			}
+
+			step.Name = HookOnFailure
+
+			failureMetrics, _ := p.RunStep(ctx, stepsgen, step)
 
-			return metrics, err
+			return append(metrics, failureMetrics...), err
 		}
 	}
 	return metrics, nil
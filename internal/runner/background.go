@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"sync"
+
 	"github.com/hidracloud/hidra/v3/config"
 	"github.com/hidracloud/hidra/v3/internal/metrics"
 )
@@ -10,6 +12,9 @@ var (
 	BackgroundTask = []func() ([]*metrics.Metric, *config.SampleConfig, error){}
 	// DisableBackgroundTask disable background task
 	DisableBackgroundTask = false
+
+	// backgroundTaskMutex guards BackgroundTask, registered from concurrent steps.
+	backgroundTaskMutex sync.Mutex
 )
 
 // RegisterBackgroundTask register a background task
@@ -17,11 +22,15 @@ func RegisterBackgroundTask(f func() ([]*metrics.Metric, *config.SampleConfig, e
 	if DisableBackgroundTask {
 		return
 	}
+	backgroundTaskMutex.Lock()
+	defer backgroundTaskMutex.Unlock()
 	BackgroundTask = append(BackgroundTask, f)
 }
 
 // GetNextBackgroundTask return the next background task
 func GetNextBackgroundTask() func() ([]*metrics.Metric, *config.SampleConfig, error) {
+	backgroundTaskMutex.Lock()
+	defer backgroundTaskMutex.Unlock()
 	if len(BackgroundTask) == 0 {
 		return nil
 	}
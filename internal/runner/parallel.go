@@ -0,0 +1,205 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/hidracloud/hidra/v3/config"
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/misc"
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+)
+
+// parallelResult is the result of a child of a parallel group.
+type parallelResult struct {
+	metrics     []*metrics.Metric
+	err         error
+	variables   map[string]string
+	attachments map[string][]byte
+}
+
+// runGroup runs a group of steps, in order or in parallel.
+func (r *run) runGroup(ctx context.Context, step *config.StepConfig, id string) ([]*metrics.Metric, error) {
+	if len(step.Parallel) > 0 {
+		return r.runParallel(ctx, step, id)
+	}
+
+	allMetrics, failedID, err := r.runSteps(ctx, step.Steps, id+".")
+
+	if err != nil {
+		return allMetrics, fmt.Errorf("step %s: %s", failedID, err)
+	}
+
+	return allMetrics, nil
+}
+
+// runParallel runs the children of a parallel group concurrently. Each child works on its own copy of
+// the plugins state and the variables, so no state is shared between goroutines. The group fails if
+// any child fails, after all of them are finished, or if two children register the same variable.
+func (r *run) runParallel(ctx context.Context, step *config.StepConfig, id string) ([]*metrics.Metric, error) {
+	results := make([]parallelResult, len(step.Parallel))
+
+	// The parent doesn't change its variables while the children run.
+	base := r.template.Variables
+
+	var wg sync.WaitGroup
+
+	for i := range step.Parallel {
+		child := r.derive()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			childID := fmt.Sprintf("%s.%d", id, i)
+
+			newMetrics, err := child.runStepWithCondition(ctx, &step.Parallel[i], childID)
+
+			if err != nil {
+				err = fmt.Errorf("step %s: %s", childID, err)
+			} else {
+				newMetrics = append(newMetrics, child.runPluginsHook(ctx, plugins.HookOnSuccess)...)
+			}
+
+			attachments, _ := child.stepsgen[misc.ContextAttachment].(map[string][]byte)
+
+			// Only close what the child opened, the rest belongs to the parent.
+			for k, v := range child.stepsgen {
+				if parentValue, ok := r.stepsgen[k]; ok && sameValue(parentValue, v) {
+					delete(child.stepsgen, k)
+				}
+			}
+
+			child.runPluginsHook(ctx, plugins.HookOnClose)
+
+			results[i] = parallelResult{
+				metrics:     newMetrics,
+				err:         err,
+				variables:   changedVariables(base, child.template.Variables),
+				attachments: attachments,
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	var allMetrics []*metrics.Metric
+	errs := []error{}
+
+	parentAttachments, _ := r.stepsgen[misc.ContextAttachment].(map[string][]byte)
+
+	// registeredBy is the child which registered each variable.
+	registeredBy := make(map[string]int)
+
+	for i, result := range results {
+		allMetrics = append(allMetrics, result.metrics...)
+
+		if result.err != nil {
+			errs = append(errs, result.err)
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(result.variables)) {
+			if other, ok := registeredBy[name]; ok {
+				errs = append(errs, fmt.Errorf("variable %s registered by steps %s.%d and %s.%d", name, id, other, id, i))
+				continue
+			}
+
+			registeredBy[name] = i
+			r.template.Variables[name] = result.variables[name]
+		}
+
+		if parentAttachments != nil {
+			for name, data := range result.attachments {
+				parentAttachments[fmt.Sprintf("%s.%d-%s", id, i, name)] = data
+			}
+		}
+	}
+
+	return allMetrics, errors.Join(errs...)
+}
+
+// changedVariables returns the variables of a child of a parallel group which are new or differ from
+// the ones it started with.
+func changedVariables(base, variables map[string]string) map[string]string {
+	changed := make(map[string]string)
+
+	for name, value := range variables {
+		if baseValue, ok := base[name]; !ok || baseValue != value {
+			changed[name] = value
+		}
+	}
+
+	return changed
+}
+
+// derive returns the run of a child of a parallel group. Maps of strings in the plugins state, like the
+// HTTP headers, are copied so the child can change them, and attachments start empty. Connections,
+// sessions, clients and browsers aren't inherited, so each child opens its own. The cookie jar is
+// shared, it is safe for concurrent use.
+func (r *run) derive() *run {
+	child := make(map[string]any, len(r.stepsgen))
+
+	for k, v := range r.stepsgen {
+		if slices.Contains(misc.RunResources, k) {
+			continue
+		}
+
+		if value, ok := v.(map[string]string); ok {
+			child[k] = maps.Clone(value)
+			continue
+		}
+
+		child[k] = v
+	}
+
+	child[misc.ContextAttachment] = make(map[string][]byte)
+
+	return &run{
+		stepsgen:       child,
+		template:       r.template.derive(),
+		pluginsByNames: make(map[string]plugins.PluginInterface),
+		hooks:          r.hooks,
+		retrying:       r.retrying,
+	}
+}
+
+// derive returns a copy of the template for a child of a parallel group.
+func (s *StepParamTemplate) derive() *StepParamTemplate {
+	return &StepParamTemplate{
+		Env:       s.Env,
+		Date:      s.Date,
+		Context:   s.Context,
+		Variables: maps.Clone(s.Variables),
+		Results:   slices.Clone(s.Results),
+	}
+}
+
+// sameValue returns true if two values of the plugins state are the same. Maps, slices, functions and
+// pointers are compared by reference.
+func sameValue(a, b any) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	if !va.IsValid() || !vb.IsValid() {
+		return !va.IsValid() && !vb.IsValid()
+	}
+
+	if va.Type() != vb.Type() {
+		return false
+	}
+
+	switch va.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Func, reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		return va.Pointer() == vb.Pointer()
+	}
+
+	if va.Type().Comparable() {
+		return va.Equal(vb)
+	}
+
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -24,6 +25,21 @@ type StepParamTemplate struct {
 	Date      time.Time
 	Context   context.Context
 	Variables map[string]string
+	Results   []StepResult
+	// Step is the id of the running step, like 2 or 3.1.
+	Step string
+}
+
+// StepResult represents the result of a step, available to the next steps templates.
+type StepResult struct {
+	// Plugin is the plugin of the step.
+	Plugin string
+	// Action is the action of the step.
+	Action string
+	// Skipped is true if the step condition was not met.
+	Skipped bool
+	// Iterations is the number of times the step was run.
+	Iterations int
 }
 
 // RunnerResult represents the result of a runner.
@@ -47,23 +63,58 @@ func (s *StepParamTemplate) GetContext(key string) string {
 	return value.(string)
 }
 
+// render renders one template.
+func (s *StepParamTemplate) render(text string) (string, error) {
+	t, err := template.New("").Funcs(utils.TemplateFuncs()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, s)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
 // Replace replaces the template.
 func (s *StepParamTemplate) Replace(m map[string]string) (map[string]string, error) {
 	result := make(map[string]string)
 	for k, v := range m {
-		t, err := template.New("").Parse(v)
+		value, err := s.render(v)
 		if err != nil {
 			return nil, err
 		}
 
-		var buf bytes.Buffer
-		err = t.Execute(&buf, s)
-		if err != nil {
-			return nil, err
-		}
+		result[k] = value
+	}
+	return result, nil
+}
+
+// Eval evaluates a template expression as a boolean. Empty expressions are true.
+func (s *StepParamTemplate) Eval(expression string) (bool, error) {
+	if strings.TrimSpace(expression) == "" {
+		return true, nil
+	}
 
-		result[k] = buf.String()
+	value, err := s.render(expression)
+	if err != nil {
+		return false, err
 	}
+
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return false, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("expression %s must evaluate to a boolean, got %q", expression, value)
+	}
+
 	return result, nil
 }
 
@@ -79,14 +130,31 @@ func RestoreOriginParamsMetrics(metrics []*metrics.Metric, params map[string]str
 	return metrics
 }
 
-// RunWithVariables runs the step with variables.
-func RunWithVariables(ctx context.Context, variables map[string]string, stepsgen map[string]any, sample *config.SampleConfig) ([]*metrics.Metric, error) {
-	var allMetrics, newMetrics []*metrics.Metric
+// RegisterVariables saves the values extracted from the step output as variables.
+func RegisterVariables(ctx context.Context, registers []config.RegisterConfig, stepsgen map[string]any, variables map[string]string) error {
+	for _, register := range registers {
+		extractor := plugins.GetExtractor(register.From)
+
+		if extractor == nil {
+			return fmt.Errorf("register %s: extractor %s not found", register.Name, register.From)
+		}
 
-	depthSize := 1
-	lastPlugin := ""
-	pluginsByNames := make(map[string]plugins.PluginInterface)
+		value, err := extractor(ctx, register.Expression, stepsgen)
+
+		if err != nil {
+			return fmt.Errorf("register %s: %s", register.Name, err)
+		}
+
+		log.Debugf("|__ Registered variable %s", register.Name)
+
+		variables[register.Name] = value
+	}
 
+	return nil
+}
+
+// RunWithVariables runs the step with variables.
+func RunWithVariables(ctx context.Context, variables map[string]string, stepsgen map[string]any, sample *config.SampleConfig) ([]*metrics.Metric, error) {
 	stepParamTemplate := StepParamTemplate{
 		Env:     utils.EnvToMap(),
 		Date:    time.Now(),
@@ -101,21 +169,26 @@ func RunWithVariables(ctx context.Context, variables map[string]string, stepsgen
 
 	stepParamTemplate.Variables = variables
 
+	hooks := config.HooksConfig{}
+
+	for _, hook := range config.SampleHooks {
+		hooks.Set(hook, resolvePlugins(sample.Hooks.Get(hook), ""))
+	}
+
+	r := &run{
+		stepsgen:       stepsgen,
+		template:       &stepParamTemplate,
+		pluginsByNames: make(map[string]plugins.PluginInterface),
+		hooks:          &hooks,
+	}
+
+	if sample.Path != "" {
+		stepsgen[misc.ContextSamplePath] = sample.Path
+	}
+
 	// cleanup
 	defer func() {
-		for _, plugin := range pluginsByNames {
-			if plugin.StepExists("onClose") {
-				_, err = plugin.RunStep(ctx, stepsgen, &plugins.Step{
-					Name: "onClose",
-					Args: map[string]string{},
-				})
-
-				if err != nil {
-					log.Warnf("Error closing plugin: %v", err)
-					err = nil
-				}
-			}
-		}
+		r.runPluginsHook(ctx, plugins.HookOnClose)
 
 		for step := range stepsgen {
 			switch step {
@@ -132,68 +205,63 @@ func RunWithVariables(ctx context.Context, variables map[string]string, stepsgen
 	}()
 
 	startTime := time.Now()
-	stepCounter := 0
-	for _, step := range sample.Steps {
-		// Check if timeout is reached in context, if so, stop the execution
-		if ctx.Err() != nil {
-			log.Warnf("Timeout reached, stopping execution of sample %s", sample.Name)
-			return allMetrics, ctx.Err()
-		}
 
-		log.Debugf("|%s Running plugin %s", strings.Repeat("_", depthSize), step.Plugin)
-		log.Debugf("|_%s Action: %v", strings.Repeat("_", depthSize), step.Action)
-		log.Debugf("|_%s Parameters: ", strings.Repeat("_", depthSize))
+	allMetrics, err := r.runSampleHook(ctx, plugins.HookOnStart, "", "")
+	failedID := plugins.HookOnStart
 
-		stepParamTemplate.Context = ctx
+	if err == nil {
+		var newMetrics []*metrics.Metric
+		newMetrics, failedID, err = r.runSteps(ctx, resolvePlugins(sample.Steps, ""), "")
+		allMetrics = append(allMetrics, newMetrics...)
+	}
 
-		params, err := stepParamTemplate.Replace(step.Parameters)
+	if err == nil {
+		var newMetrics []*metrics.Metric
+		newMetrics, err = r.runSampleHook(ctx, plugins.HookOnSuccess, "", "")
+		failedID = plugins.HookOnSuccess
+		allMetrics = append(allMetrics, newMetrics...)
+	}
 
-		if err != nil {
-			return nil, err
+	if ctx.Err() != nil && err == ctx.Err() {
+		log.Warnf("Timeout reached, stopping execution of sample %s", sample.Name)
+		return allMetrics, err
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%s#%s: %s", sample.Path, failedID, err)
+		report := report.NewReport(sample, allMetrics, variables, time.Since(startTime), stepsgen, err)
+		rErr := report.Save()
+		if rErr != nil {
+			log.Warn(rErr)
 		}
+		return allMetrics, err
+	}
 
-		for k, v := range params {
-			log.Debugf("|__%s %s: %v", strings.Repeat("_", depthSize), k, v)
+	return append(allMetrics, r.runPluginsHook(ctx, plugins.HookOnSuccess)...), nil
+}
+
+// resolvePlugins returns a copy of the steps where the steps without plugin use the plugin of the
+// previous step. The children of a group start with the plugin used before the group.
+func resolvePlugins(steps []config.StepConfig, lastPlugin string) []config.StepConfig {
+	resolved := make([]config.StepConfig, len(steps))
+
+	for i, step := range steps {
+		if step.IsGroup() {
+			step.Parallel = resolvePlugins(step.Parallel, lastPlugin)
+			step.Steps = resolvePlugins(step.Steps, lastPlugin)
+			resolved[i] = step
+			continue
 		}
 
-		depthSize++
 		if step.Plugin == "" {
 			step.Plugin = lastPlugin
 		}
-		plugin := plugins.GetPlugin(step.Plugin)
-
-		if plugin == nil {
-			return allMetrics, fmt.Errorf("plugin %s not found", step.Plugin)
-		}
 
 		lastPlugin = step.Plugin
-		pluginsByNames[step.Plugin] = plugin
-
-		newMetrics, err = plugin.RunStep(ctx, stepsgen, &plugins.Step{
-			Name:          step.Action,
-			Args:          params,
-			Negate:        step.Negate,
-			IgnoreOnError: step.IgnoreOnError,
-			Timeout:       step.Timeout,
-		})
-
-		originMetrics := RestoreOriginParamsMetrics(newMetrics, step.Parameters)
-		allMetrics = append(allMetrics, originMetrics...)
-
-		if err != nil {
-			err = fmt.Errorf("%s#%d: %s", sample.Path, stepCounter, err)
-			report := report.NewReport(sample, allMetrics, variables, time.Since(startTime), stepsgen, err)
-			rErr := report.Save()
-			if rErr != nil {
-				log.Warn(rErr)
-			}
-			return allMetrics, err
-		}
-
-		stepCounter++
+		resolved[i] = step
 	}
 
-	return allMetrics, err
+	return resolved
 }
 
 // RunSample runs a sample.
@@ -0,0 +1,649 @@
+package runner_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hidracloud/hidra/v3/config"
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+	"github.com/hidracloud/hidra/v3/internal/runner"
+
+	_ "github.com/hidracloud/hidra/v3/internal/plugins/all"
+)
+
+// newTestServer returns a server answering with the token sent in the Authorization header.
+func newTestServer() *httptest.Server {
+	jobCalls, flakyCalls := 0, 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Request-Id", "abc")
+			fmt.Fprint(w, `{"data": {"token": "s3cr3t"}}`)
+		case "/job":
+			jobCalls++
+			if jobCalls < 3 {
+				fmt.Fprint(w, `{"status": "pending"}`)
+				return
+			}
+			fmt.Fprint(w, `{"status": "done"}`)
+		case "/flaky":
+			flakyCalls++
+			if flakyCalls < 3 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			fmt.Fprint(w, "ok")
+		default:
+			fmt.Fprintf(w, "authorization: %s", r.Header.Get("Authorization"))
+		}
+	}))
+}
+
+// loadSample loads a sample from yaml, failing the test on error.
+func loadSample(t *testing.T, data string) *config.SampleConfig {
+	sample, err := config.LoadSampleConfig([]byte(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sample
+}
+
+func TestRegisterVariables(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	sample := loadSample(t, `
+description: register
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/login
+    register:
+      - name: token
+        from: jsonpath
+        expression: $.data.token
+      - name: requestID
+        from: header
+        expression: X-Request-Id
+  - action: addHTTPHeader
+    parameters:
+      key: Authorization
+      value: "Bearer {{ .Variables.token }}-{{ .Variables.requestID }}"
+  - action: request
+    parameters:
+      url: `+server.URL+`/private
+  - plugin: string
+    action: outputShouldContain
+    parameters:
+      search: "Bearer s3cr3t-abc"
+`)
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error != nil {
+		t.Error(result.Error)
+	}
+
+	sample = loadSample(t, `
+description: register
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/login
+    register:
+      - name: token
+        from: jsonpath
+        expression: $.data.missing
+`)
+
+	result = runner.RunSample(context.TODO(), sample)
+
+	if result.Error == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestConditionsAndLoops(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	sample := loadSample(t, `
+description: conditions
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/job
+    register:
+      - name: status
+        from: jsonpath
+        expression: $.status
+    repeat:
+      until: '{{ eq .Variables.status "done" }}'
+      times: 5
+      interval: 1ms
+  - plugin: string
+    action: outputShouldContain
+    parameters:
+      search: "never"
+    when: '{{ ne .Variables.status "done" }}'
+  - plugin: string
+    action: outputShouldContain
+    parameters:
+      search: "done"
+    when: '{{ (index .Results 1).Skipped }}'
+`)
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error != nil {
+		t.Error(result.Error)
+	}
+
+	iterations := 0.0
+	for _, metric := range result.Metrics {
+		if metric.Name == runner.StepIterationsMetric {
+			iterations = metric.Value
+		}
+	}
+
+	if iterations != 3 {
+		t.Errorf("expected 3 iterations, got %f", iterations)
+	}
+
+	sample = loadSample(t, `
+description: conditions
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/login
+    repeat:
+      until: '{{ eq .Variables.status "done" }}'
+      times: 2
+`)
+
+	result = runner.RunSample(context.TODO(), sample)
+
+	if result.Error == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStepRetry(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	sample := loadSample(t, `
+description: retry
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/flaky
+    retry: 3
+    retryDelay: 1ms
+    retryBackoff: exponential
+    retryJitter: true
+`)
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error != nil {
+		t.Error(result.Error)
+	}
+
+	retries := 0.0
+	for _, metric := range result.Metrics {
+		if metric.Name == runner.StepRetriesMetric {
+			retries = metric.Value
+		}
+	}
+
+	if retries != 2 {
+		t.Errorf("expected 2 retries, got %f", retries)
+	}
+}
+
+// flakyPlugin fails the first steps and records the onFailure hooks run.
+type flakyPlugin struct {
+	plugins.BasePlugin
+	failures  int
+	onFailure int
+}
+
+// Init initializes the plugin.
+func (p *flakyPlugin) Init() {
+	p.Primitives()
+
+	p.RegisterStep(&plugins.StepDefinition{
+		Name: "run",
+		Fn: func(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+			if p.failures > 0 {
+				p.failures--
+				return nil, fmt.Errorf("flaky failure")
+			}
+
+			return nil, nil
+		},
+	})
+
+	p.RegisterStep(&plugins.StepDefinition{
+		Name: plugins.HookOnFailure,
+		Fn: func(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+			p.onFailure++
+			return nil, nil
+		},
+	})
+}
+
+func TestStepRetryOnFailure(t *testing.T) {
+	p := &flakyPlugin{}
+	p.Init()
+	plugins.AddPlugin("flaky", "Fails the first steps", p)
+
+	sample := loadSample(t, `
+description: retry
+steps:
+  - plugin: flaky
+    action: run
+    retry: 2
+    retryDelay: 1ms
+`)
+
+	for _, test := range []struct {
+		failures  int
+		success   bool
+		onFailure int
+	}{
+		{failures: 2, success: true, onFailure: 0},
+		{failures: 3, success: false, onFailure: 1},
+	} {
+		p.failures, p.onFailure = test.failures, 0
+
+		result := runner.RunSample(context.TODO(), sample)
+
+		if (result.Error == nil) != test.success {
+			t.Errorf("%d failures: unexpected result %v", test.failures, result.Error)
+		}
+
+		if p.onFailure != test.onFailure {
+			t.Errorf("%d failures: expected onFailure to run %d times, got %d", test.failures, test.onFailure, p.onFailure)
+		}
+	}
+}
+
+func TestParallelSteps(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	sample := loadSample(t, `
+description: parallel
+steps:
+  - plugin: http
+    action: addHTTPHeader
+    parameters:
+      key: Authorization
+      value: parent
+  - parallel:
+      - steps:
+          - action: addHTTPHeader
+            parameters:
+              key: Authorization
+              value: child
+          - action: request
+            parameters:
+              url: `+server.URL+`/
+            register:
+              - name: child
+                from: output
+      - action: request
+        parameters:
+          url: `+server.URL+`/
+        register:
+          - name: parent
+            from: output
+  - action: request
+    parameters:
+      url: `+server.URL+`/
+    when: '{{ and (eq .Variables.child "authorization: child") (eq .Variables.parent "authorization: parent") }}'
+  - action: bodyShouldContain
+    parameters:
+      search: "authorization: parent"
+`)
+
+	if err := sample.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	sample = loadSample(t, `
+description: parallel failure
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/
+  - parallel:
+      - action: statusCodeShouldBe
+        parameters:
+          statusCode: "500"
+      - action: statusCodeShouldBe
+        parameters:
+          statusCode: "200"
+`)
+
+	result = runner.RunSample(context.TODO(), sample)
+
+	if result.Error == nil {
+		t.Error("expected the parallel group to fail")
+	}
+}
+
+func TestParallelVariables(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	sample := loadSample(t, `
+description: parallel variables
+variables:
+  - token: initial
+steps:
+  - parallel:
+      - plugin: http
+        action: request
+        parameters:
+          url: `+server.URL+`/login
+        register:
+          - name: token
+            from: jsonpath
+            expression: $.data.token
+      - plugin: http
+        action: request
+        parameters:
+          url: `+server.URL+`/
+        register:
+          - name: other
+            from: output
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/
+    when: '{{ and (eq .Variables.token "s3cr3t") (eq .Variables.other "authorization: ") }}'
+  - action: bodyShouldContain
+    parameters:
+      search: "authorization"
+`)
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	executed := false
+
+	for _, metric := range result.Metrics {
+		if metric.Name == runner.StepSuccessMetric && metric.Labels["step"] == "1" {
+			executed = true
+		}
+	}
+
+	if !executed {
+		t.Error("expected the variables registered by both branches")
+	}
+
+	sample = loadSample(t, `
+description: parallel conflict
+steps:
+  - parallel:
+      - plugin: http
+        action: request
+        parameters:
+          url: `+server.URL+`/login
+        register:
+          - name: token
+            from: output
+      - plugin: http
+        action: request
+        parameters:
+          url: `+server.URL+`/
+        register:
+          - name: token
+            from: output
+`)
+
+	result = runner.RunSample(context.TODO(), sample)
+
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "variable token registered by steps 0.0 and 0.1") {
+		t.Errorf("expected a conflict on the token variable, got %v", result.Error)
+	}
+}
+
+func TestStepMetrics(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	sample := loadSample(t, `
+description: step metrics
+steps:
+  - plugin: http
+    action: request
+    parameters:
+      url: `+server.URL+`/
+  - action: statusCodeShouldBe
+    parameters:
+      statusCode: "500"
+`)
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error == nil {
+		t.Fatal("expected the sample to fail")
+	}
+
+	success := map[string]float64{}
+	durations := 0
+
+	for _, metric := range result.Metrics {
+		switch metric.Name {
+		case runner.StepSuccessMetric:
+			success[metric.Labels["step"]+" "+metric.Labels["plugin"]+" "+metric.Labels["action"]] = metric.Value
+		case runner.StepDurationMetric:
+			durations++
+		}
+	}
+
+	if success["0 http request"] != 1 || success["1 http statusCodeShouldBe"] != 0 || len(success) != 2 {
+		t.Errorf("unexpected step success metrics %v", success)
+	}
+
+	if durations != 2 {
+		t.Errorf("expected 2 step duration metrics, got %d", durations)
+	}
+}
+
+// hooksPlugin records the steps and hooks run.
+type hooksPlugin struct {
+	plugins.BasePlugin
+	calls []string
+}
+
+// Init initializes the plugin.
+func (p *hooksPlugin) Init() {
+	p.Primitives()
+
+	record := func(name string) func(context.Context, map[string]string, map[string]any) ([]*metrics.Metric, error) {
+		return func(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+			p.calls = append(p.calls, name+args["name"])
+			return nil, nil
+		}
+	}
+
+	p.RegisterStep(&plugins.StepDefinition{
+		Name:   "record",
+		Params: []plugins.StepParam{{Name: "name"}},
+		Fn:     record(""),
+	})
+
+	for _, hook := range []string{plugins.HookOnStart, plugins.HookBeforeEach, plugins.HookAfterEach, plugins.HookOnSuccess, plugins.HookOnClose} {
+		p.RegisterStep(&plugins.StepDefinition{Name: hook, Fn: record(hook)})
+	}
+}
+
+func TestHooks(t *testing.T) {
+	p := &hooksPlugin{}
+	p.Init()
+	plugins.AddPlugin("hooks", "Records the hooks", p)
+
+	sample := loadSample(t, `
+description: hooks
+hooks:
+  onStart:
+    - plugin: hooks
+      action: record
+      parameters:
+        name: sample.onStart
+  afterEach:
+    - plugin: hooks
+      action: record
+      parameters:
+        name: "sample.afterEach.{{ .Step }}"
+  onSuccess:
+    - plugin: hooks
+      action: record
+      parameters:
+        name: sample.onSuccess
+steps:
+  - plugin: hooks
+    action: record
+    parameters:
+      name: step0
+  - action: record
+    parameters:
+      name: step1
+`)
+
+	if err := sample.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runner.RunSample(context.TODO(), sample)
+
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	expected := []string{
+		"onStart",
+		"sample.onStart",
+		"beforeEach",
+		"step0",
+		"afterEach",
+		"sample.afterEach.0",
+		"beforeEach",
+		"step1",
+		"afterEach",
+		"sample.afterEach.1",
+		"sample.onSuccess",
+		"onSuccess",
+		"onClose",
+	}
+
+	if strings.Join(p.calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected calls %v, got %v", expected, p.calls)
+	}
+}
+
+// failingHooksPlugin fails its fail step and its afterEach hook.
+type failingHooksPlugin struct {
+	plugins.BasePlugin
+	runs int
+}
+
+// Init initializes the plugin.
+func (p *failingHooksPlugin) Init() {
+	p.Primitives()
+
+	p.RegisterStep(&plugins.StepDefinition{
+		Name: "run",
+		Fn: func(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+			p.runs++
+			return nil, nil
+		},
+	})
+
+	for _, name := range []string{"fail", plugins.HookAfterEach} {
+		p.RegisterStep(&plugins.StepDefinition{
+			Name: name,
+			Fn: func(ctx context.Context, args map[string]string, stepsgen map[string]any) ([]*metrics.Metric, error) {
+				return nil, fmt.Errorf("failing hook")
+			},
+		})
+	}
+}
+
+func TestHooksOfOtherPlugins(t *testing.T) {
+	recorder := &hooksPlugin{}
+	recorder.Init()
+	plugins.AddPlugin("recorder", "Records the hooks", recorder)
+
+	failing := &failingHooksPlugin{}
+	failing.Init()
+	plugins.AddPlugin("failingHooks", "Fails the hooks", failing)
+
+	hooks := `
+description: hooks
+hooks:
+  afterEach:
+    - plugin: failingHooks
+      action: fail
+steps:
+`
+
+	// The afterEach hook step of failingHooks doesn't run around the steps of recorder.
+	result := runner.RunSample(context.TODO(), loadSample(t, hooks+`
+  - plugin: recorder
+    action: record
+    parameters:
+      name: step0
+`))
+
+	if result.Error != nil {
+		t.Errorf("expected the hook step not to run, got %v", result.Error)
+	}
+
+	if strings.Join(recorder.calls, ",") != "onStart,beforeEach,step0,afterEach,onSuccess,onClose" {
+		t.Errorf("unexpected calls %v", recorder.calls)
+	}
+
+	// The failing afterEach hook of the plugin is only logged, the one of the sample fails the step.
+	result = runner.RunSample(context.TODO(), loadSample(t, hooks+`
+  - plugin: failingHooks
+    action: run
+`))
+
+	if failing.runs != 1 {
+		t.Errorf("expected the step to run once, got %d", failing.runs)
+	}
+
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "hook 0.afterEach.0: failing hook") {
+		t.Errorf("expected the sample hook to fail the step, got %v", result.Error)
+	}
+}
@@ -0,0 +1,476 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hidracloud/hidra/v3/config"
+	"github.com/hidracloud/hidra/v3/internal/metrics"
+	"github.com/hidracloud/hidra/v3/internal/plugins"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StepDurationMetric is the name of the metric with the duration of each step, in seconds.
+	StepDurationMetric = "step_duration"
+	// StepSuccessMetric is the name of the metric with the result of each step.
+	StepSuccessMetric = "step_success"
+	// StepIterationsMetric is the name of the metric with the iterations run by a repeated step.
+	StepIterationsMetric = "step_iterations"
+	// StepRetriesMetric is the name of the metric with the retries of a step.
+	StepRetriesMetric = "step_retries"
+)
+
+var (
+	// StepMetricNames are the metrics emitted for every step, replaced on each run of a sample.
+	StepMetricNames = []string{StepDurationMetric, StepSuccessMetric, StepIterationsMetric, StepRetriesMetric}
+
+	// defaultRepeatTimes is the max number of iterations of a step repeated until a condition holds.
+	defaultRepeatTimes = 10
+
+	// defaultRetryDelay is the delay before the first retry of a step.
+	defaultRetryDelay = time.Second
+
+	// maxRetryDelay is the longest delay between retries with exponential backoff, unless the delay
+	// before the first retry is longer.
+	maxRetryDelay = time.Minute
+)
+
+// run is the state of one run of a sample, shared by its steps.
+type run struct {
+	// stepsgen is the state of the plugins.
+	stepsgen map[string]any
+	// template renders the step parameters.
+	template *StepParamTemplate
+	// pluginsByNames are the plugins used by the run.
+	pluginsByNames map[string]plugins.PluginInterface
+	// hooks are the sample hooks.
+	hooks *config.HooksConfig
+	// inHook is true while running the steps of a hook, which don't trigger other hooks.
+	inHook bool
+	// retrying is the number of steps being run which will be retried if they fail. The failures of
+	// their steps don't run the onFailure hooks of the plugins until the last attempt.
+	retrying int
+}
+
+// runPluginHook runs a hook of a plugin. Errors are logged, they don't fail the step.
+func (r *run) runPluginHook(ctx context.Context, plugin plugins.PluginInterface, hook string) []*metrics.Metric {
+	if !plugin.StepExists(hook) {
+		return nil
+	}
+
+	newMetrics, err := plugin.RunStep(ctx, r.stepsgen, &plugins.Step{
+		Name: hook,
+		Args: map[string]string{},
+	})
+
+	if err != nil {
+		log.Warnf("Error running hook %s: %v", hook, err)
+	}
+
+	return newMetrics
+}
+
+// runPluginsHook runs a hook of all the plugins used by the run.
+func (r *run) runPluginsHook(ctx context.Context, hook string) []*metrics.Metric {
+	var allMetrics []*metrics.Metric
+
+	for _, plugin := range r.pluginsByNames {
+		allMetrics = append(allMetrics, r.runPluginHook(ctx, plugin, hook)...)
+	}
+
+	return allMetrics
+}
+
+// runSampleHook runs the steps of a sample hook. Prefix identifies the hook steps. If plugin is not
+// empty, only the groups and the steps of that plugin are run.
+func (r *run) runSampleHook(ctx context.Context, hook, prefix, plugin string) ([]*metrics.Metric, error) {
+	steps := r.hooks.Get(hook)
+
+	if plugin != "" {
+		steps = stepsOfPlugin(steps, plugin)
+	}
+
+	if len(steps) == 0 || r.inHook {
+		return nil, nil
+	}
+
+	r.inHook = true
+	defer func() { r.inHook = false }()
+
+	allMetrics, failedID, err := r.runSteps(ctx, steps, prefix+hook+".")
+
+	if err != nil {
+		return allMetrics, fmt.Errorf("hook %s: %s", failedID, err)
+	}
+
+	return allMetrics, nil
+}
+
+// stepsOfPlugin returns the groups and the steps of a plugin, as a step of another plugin may not
+// be able to run yet, e.g. a browser screenshot before the first navigateTo.
+func stepsOfPlugin(steps []config.StepConfig, plugin string) []config.StepConfig {
+	var filtered []config.StepConfig
+
+	for _, step := range steps {
+		if step.IsGroup() || step.Plugin == plugin {
+			filtered = append(filtered, step)
+		}
+	}
+
+	return filtered
+}
+
+// runSteps runs a list of steps in order. Prefix is prepended to the index of each step to build its
+// id. It returns the id of the step that failed, if any.
+func (r *run) runSteps(ctx context.Context, steps []config.StepConfig, prefix string) ([]*metrics.Metric, string, error) {
+	var allMetrics []*metrics.Metric
+
+	for i := range steps {
+		id := prefix + strconv.Itoa(i)
+
+		// Check if timeout is reached in context, if so, stop the execution
+		if ctx.Err() != nil {
+			return allMetrics, id, ctx.Err()
+		}
+
+		newMetrics, err := r.runStepWithCondition(ctx, &steps[i], id)
+		allMetrics = append(allMetrics, newMetrics...)
+
+		if err != nil {
+			return allMetrics, id, err
+		}
+	}
+
+	return allMetrics, "", nil
+}
+
+// runStepWithCondition runs a step if its condition is met, and saves its result for the next steps.
+func (r *run) runStepWithCondition(ctx context.Context, step *config.StepConfig, id string) ([]*metrics.Metric, error) {
+	result := StepResult{
+		Plugin: step.Plugin,
+		Action: step.Action,
+	}
+
+	r.template.Context = ctx
+
+	shouldRun, err := r.template.Eval(step.When)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !shouldRun {
+		log.Debugf("|_ Skipping step %s, condition %s not met", id, step.When)
+		result.Skipped = true
+		r.template.Results = append(r.template.Results, result)
+		return nil, nil
+	}
+
+	startTime := time.Now()
+	newMetrics, iterations, err := r.runStepWithRepeat(ctx, step, id)
+	newMetrics = append(newMetrics, stepMetrics(step, id, time.Since(startTime), err)...)
+
+	if err != nil {
+		return newMetrics, err
+	}
+
+	result.Iterations = iterations
+	r.template.Results = append(r.template.Results, result)
+
+	return newMetrics, nil
+}
+
+// runStep runs one step of a sample.
+func (r *run) runStep(ctx context.Context, step *config.StepConfig, id string) ([]*metrics.Metric, error) {
+	if step.IsGroup() {
+		return r.runGroup(ctx, step, id)
+	}
+
+	depth := strings.Repeat("_", strings.Count(id, ".")+1)
+
+	log.Debugf("|%s Running plugin %s", depth, step.Plugin)
+	log.Debugf("|_%s Action: %v", depth, step.Action)
+	log.Debugf("|_%s Parameters: ", depth)
+
+	if !r.inHook {
+		r.template.Step = id
+	}
+
+	params, err := r.template.Replace(step.Parameters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plugin := plugins.GetPlugin(step.Plugin)
+
+	if plugin == nil {
+		return nil, fmt.Errorf("plugin %s not found", step.Plugin)
+	}
+
+	logParams := params
+
+	if definition, ok := plugin.GetSteps()[step.Action]; ok {
+		logParams = definition.MaskSecrets(params)
+	}
+
+	for k, v := range logParams {
+		log.Debugf("|__%s %s: %v", depth, k, v)
+	}
+
+	var allMetrics []*metrics.Metric
+
+	if _, ok := r.pluginsByNames[step.Plugin]; !ok {
+		r.pluginsByNames[step.Plugin] = plugin
+		allMetrics = append(allMetrics, r.runPluginHook(ctx, plugin, plugins.HookOnStart)...)
+	}
+
+	if r.inHook {
+		newMetrics, err := r.runPluginStep(ctx, plugin, step, params)
+		return append(allMetrics, newMetrics...), err
+	}
+
+	hookMetrics, err := r.runSampleHook(ctx, plugins.HookBeforeEach, id+".", step.Plugin)
+	allMetrics = append(allMetrics, hookMetrics...)
+
+	if err != nil {
+		return allMetrics, err
+	}
+
+	allMetrics = append(allMetrics, r.runPluginHook(ctx, plugin, plugins.HookBeforeEach)...)
+
+	newMetrics, err := r.runPluginStep(ctx, plugin, step, params)
+	allMetrics = append(allMetrics, newMetrics...)
+
+	allMetrics = append(allMetrics, r.runPluginHook(ctx, plugin, plugins.HookAfterEach)...)
+
+	hookMetrics, hookErr := r.runSampleHook(ctx, plugins.HookAfterEach, id+".", step.Plugin)
+	allMetrics = append(allMetrics, hookMetrics...)
+
+	if err == nil {
+		err = hookErr
+	}
+
+	return allMetrics, err
+}
+
+// runPluginStep runs the action of a step and registers its variables.
+func (r *run) runPluginStep(ctx context.Context, plugin plugins.PluginInterface, step *config.StepConfig, params map[string]string) ([]*metrics.Metric, error) {
+	newMetrics, err := plugin.RunStep(ctx, r.stepsgen, &plugins.Step{
+		Name:          step.Action,
+		Args:          params,
+		Negate:        step.Negate,
+		IgnoreOnError: step.IgnoreOnError,
+		Timeout:       step.Timeout,
+		SkipOnFailure: r.retrying > 0,
+	})
+
+	newMetrics = RestoreOriginParamsMetrics(newMetrics, step.Parameters)
+
+	if err == nil {
+		err = RegisterVariables(ctx, step.Register, r.stepsgen, r.template.Variables)
+	}
+
+	return newMetrics, err
+}
+
+// retryDelay returns the time to wait before the given retry, starting at 1.
+func retryDelay(step *config.StepConfig, retry int) time.Duration {
+	delay := step.RetryDelay
+
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	if step.RetryBackoff == config.RetryBackoffExponential {
+		limit := max(delay, maxRetryDelay)
+
+		for i := 1; i < retry && delay < limit; i++ {
+			delay *= 2
+		}
+
+		delay = min(delay, limit)
+	}
+
+	if step.RetryJitter && delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+	}
+
+	return delay
+}
+
+// runAttempt runs an attempt of a step. If it isn't the last one, the onFailure hooks don't run.
+func (r *run) runAttempt(ctx context.Context, step *config.StepConfig, id string, last bool) ([]*metrics.Metric, error) {
+	if !last {
+		r.retrying++
+		defer func() { r.retrying-- }()
+	}
+
+	return r.runStep(ctx, step, id)
+}
+
+// runStepWithRetry runs a step, retrying it when it fails. It returns the number of retries.
+func (r *run) runStepWithRetry(ctx context.Context, step *config.StepConfig, id string) ([]*metrics.Metric, int, error) {
+	newMetrics, err := r.runAttempt(ctx, step, id, step.Retry == 0)
+
+	retries := 0
+
+	for err != nil && retries < step.Retry {
+		retries++
+
+		log.Debugf("|_ Step %s failed, retrying (%d/%d): %s", id, retries, step.Retry, err)
+
+		if sleepErr := sleepWithContext(ctx, retryDelay(step, retries)); sleepErr != nil {
+			return newMetrics, retries, err
+		}
+
+		newMetrics, err = r.runAttempt(ctx, step, id, retries == step.Retry)
+	}
+
+	return newMetrics, retries, err
+}
+
+// runStepWithRepeat runs a step honouring its repeat configuration. It returns the number of iterations.
+func (r *run) runStepWithRepeat(ctx context.Context, step *config.StepConfig, id string) ([]*metrics.Metric, int, error) {
+	var allMetrics []*metrics.Metric
+	var err error
+
+	iterations, retries := 0, 0
+
+	if step.Repeat == nil {
+		allMetrics, retries, err = r.runStepWithRetry(ctx, step, id)
+		return append(allMetrics, retriesMetrics(step, id, retries)...), 1, err
+	}
+
+	times := step.Repeat.Times
+
+	if times <= 0 {
+		times = defaultRepeatTimes
+	}
+
+	for iterations < times {
+		var newMetrics []*metrics.Metric
+		var newRetries int
+
+		iterations++
+		newMetrics, newRetries, err = r.runStepWithRetry(ctx, step, id)
+		allMetrics = append(allMetrics, newMetrics...)
+		retries += newRetries
+
+		if step.Repeat.Until == "" {
+			if err != nil {
+				break
+			}
+		} else if err == nil {
+			done, evalErr := r.template.Eval(step.Repeat.Until)
+
+			if evalErr != nil {
+				err = evalErr
+				break
+			}
+
+			if done {
+				break
+			}
+
+			err = fmt.Errorf("condition %s not met after %d iterations", step.Repeat.Until, iterations)
+		}
+
+		if iterations < times {
+			if sleepErr := sleepWithContext(ctx, step.Repeat.Interval); sleepErr != nil {
+				err = sleepErr
+				break
+			}
+		}
+	}
+
+	allMetrics = append(allMetrics, &metrics.Metric{
+		Name:        StepIterationsMetric,
+		Description: "The number of iterations run by a repeated step",
+		Value:       float64(iterations),
+		Labels:      stepLabels(step, id),
+	})
+
+	return append(allMetrics, retriesMetrics(step, id, retries)...), iterations, err
+}
+
+// stepMetrics returns the duration and success metrics of a step.
+func stepMetrics(step *config.StepConfig, id string, duration time.Duration, err error) []*metrics.Metric {
+	success := 1.0
+
+	if err != nil {
+		success = 0
+	}
+
+	return []*metrics.Metric{
+		{
+			Name:        StepDurationMetric,
+			Description: "The time taken by a step, in seconds",
+			Value:       duration.Seconds(),
+			Labels:      stepLabels(step, id),
+		},
+		{
+			Name:        StepSuccessMetric,
+			Description: "1 if the step succeeded, 0 if it failed",
+			Value:       success,
+			Labels:      stepLabels(step, id),
+		},
+	}
+}
+
+// retriesMetrics returns the retries metric of a step, if it can be retried.
+func retriesMetrics(step *config.StepConfig, id string, retries int) []*metrics.Metric {
+	if step.Retry <= 0 {
+		return nil
+	}
+
+	return []*metrics.Metric{
+		{
+			Name:        StepRetriesMetric,
+			Description: "The number of retries of a step",
+			Value:       float64(retries),
+			Labels:      stepLabels(step, id),
+		},
+	}
+}
+
+// stepLabels returns the labels identifying a step in the runner metrics.
+func stepLabels(step *config.StepConfig, id string) map[string]string {
+	action := step.Action
+
+	switch {
+	case len(step.Parallel) > 0:
+		action = "parallel"
+	case len(step.Steps) > 0:
+		action = "steps"
+	}
+
+	return map[string]string{
+		"step":   id,
+		"plugin": step.Plugin,
+		"action": action,
+	}
+}
+
+// sleepWithContext sleeps for the given duration, or until the context is done.
+func sleepWithContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
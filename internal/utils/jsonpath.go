@@ -0,0 +1,500 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonPathToken represents one selector of a JSONPath expression.
+type jsonPathToken struct {
+	// key is the object key to select, if any.
+	key string
+	// index is the array index to select, if isIndex is true.
+	index int
+	// isIndex is true if the token selects an array index.
+	isIndex bool
+	// wildcard is true if the token selects every child.
+	wildcard bool
+	// recursive is true if the token selects from the node and all its descendants (..).
+	recursive bool
+	// filter selects the children matching a condition, like [?(@.status == 'up')].
+	filter *jsonPathFilter
+}
+
+// jsonPathFilter represents a filter expression like @.price < 10 or @.id.
+type jsonPathFilter struct {
+	// path selects the compared value, relative to each child (@).
+	path []jsonPathToken
+	// operator is the comparison, or empty to check if path exists.
+	operator string
+	// value is the literal the selected value is compared with.
+	value any
+}
+
+// jsonPathOperators are the comparisons allowed in filters, two characters long first.
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// jsonPathQuoted matches the quoted strings of a filter.
+var jsonPathQuoted = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+
+// parseJSONPath parses a JSONPath expression like $.items[0].name, $['a b'][*], $..id or
+// $.items[?(@.status == 'up')].
+func parseJSONPath(path string) ([]jsonPathToken, error) {
+	path = strings.TrimSpace(path)
+
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSONPath %s: must start with $", path)
+	}
+
+	tokens, err := parseJSONPathTokens(path[1:])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %s: %w", path, err)
+	}
+
+	return tokens, nil
+}
+
+// parseJSONPathTokens parses the selectors following the root ($) or current (@) node.
+func parseJSONPathTokens(rest string) ([]jsonPathToken, error) {
+	tokens := []jsonPathToken{}
+
+	for rest != "" {
+		var token jsonPathToken
+		var err error
+
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			rest = rest[2:]
+
+			if strings.HasPrefix(rest, "[") {
+				token, rest, err = parseJSONPathBracket(rest)
+			} else {
+				token, rest, err = parseJSONPathKey(rest)
+			}
+
+			token.recursive = true
+		case rest[0] == '.':
+			token, rest, err = parseJSONPathKey(rest[1:])
+		case rest[0] == '[':
+			token, rest, err = parseJSONPathBracket(rest)
+		default:
+			err = fmt.Errorf("unexpected %q", rest[0])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// parseJSONPathKey parses a key following a dot, up to the next selector.
+func parseJSONPathKey(rest string) (jsonPathToken, string, error) {
+	end := strings.IndexAny(rest, ".[")
+	if end == -1 {
+		end = len(rest)
+	}
+
+	key := rest[:end]
+
+	switch key {
+	case "":
+		return jsonPathToken{}, "", errors.New("empty key")
+	case "*":
+		return jsonPathToken{wildcard: true}, rest[end:], nil
+	}
+
+	return jsonPathToken{key: key}, rest[end:], nil
+}
+
+// parseJSONPathBracket parses a selector between brackets, like [0], ['key'], [*] or [?(@.id > 1)].
+func parseJSONPathBracket(rest string) (jsonPathToken, string, error) {
+	end := closingBracket(rest)
+	if end == -1 {
+		return jsonPathToken{}, "", errors.New("missing ]")
+	}
+
+	selector := strings.TrimSpace(rest[1:end])
+	rest = rest[end+1:]
+
+	switch {
+	case selector == "*":
+		return jsonPathToken{wildcard: true}, rest, nil
+	case strings.HasPrefix(selector, "?"):
+		filter, err := parseJSONPathFilter(selector[1:])
+		return jsonPathToken{filter: filter}, rest, err
+	case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+		return jsonPathToken{key: selector[1 : len(selector)-1]}, rest, nil
+	}
+
+	index, err := strconv.Atoi(selector)
+	if err != nil {
+		return jsonPathToken{}, "", fmt.Errorf("invalid index %s", selector)
+	}
+
+	return jsonPathToken{index: index, isIndex: true}, rest, nil
+}
+
+// closingBracket returns the position of the ] closing the bracket at the start of s, skipping the
+// brackets of nested expressions and quoted strings, or -1 if there is none.
+func closingBracket(s string) int {
+	depth := 0
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// parseJSONPathFilter parses a filter expression, like (@.status == 'up'), (@.size > 10) or (@.id).
+func parseJSONPathFilter(expr string) (*jsonPathFilter, error) {
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+
+	unquoted := jsonPathQuoted.ReplaceAllString(expr, "")
+
+	if strings.Contains(unquoted, "&&") || strings.Contains(unquoted, "||") {
+		return nil, fmt.Errorf("unsupported filter %s: only one comparison is allowed", expr)
+	}
+
+	left, operator, right := splitJSONPathFilter(expr)
+
+	if !strings.HasPrefix(left, "@") {
+		return nil, fmt.Errorf("invalid filter %s: must start with @", expr)
+	}
+
+	path, err := parseJSONPathTokens(left[1:])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %s: %w", expr, err)
+	}
+
+	filter := &jsonPathFilter{path: path, operator: operator}
+
+	if operator == "" {
+		return filter, nil
+	}
+
+	if len(right) >= 2 && right[0] == '\'' && right[len(right)-1] == '\'' {
+		filter.value = right[1 : len(right)-1]
+		return filter, nil
+	}
+
+	filter.value, err = decodeJSON([]byte(right))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %s: invalid value %s", expr, right)
+	}
+
+	return filter, nil
+}
+
+// splitJSONPathFilter splits a filter expression around its first operator outside quoted strings.
+// The operator is empty if the expression is only a path.
+func splitJSONPathFilter(expr string) (string, string, string) {
+	var quote byte
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+			continue
+		}
+
+		for _, operator := range jsonPathOperators {
+			if strings.HasPrefix(expr[i:], operator) {
+				return strings.TrimSpace(expr[:i]), operator, strings.TrimSpace(expr[i+len(operator):])
+			}
+		}
+	}
+
+	return expr, "", ""
+}
+
+// matches returns true if a node satisfies the filter.
+func (f *jsonPathFilter) matches(node any) bool {
+	values := evalJSONPath(node, f.path)
+
+	if f.operator == "" {
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		if compareJSONValues(value, f.operator, f.value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareJSONValues compares two decoded JSON values. Numbers and strings can be ordered, the other
+// values can only be checked for equality.
+func compareJSONValues(a any, operator string, b any) bool {
+	var cmp int
+
+	x, xNumber := jsonNumber(a)
+	y, yNumber := jsonNumber(b)
+	xString, xIsString := a.(string)
+	yString, yIsString := b.(string)
+
+	switch {
+	case xNumber && yNumber:
+		cmp = x.Cmp(y)
+	case xIsString && yIsString:
+		cmp = strings.Compare(xString, yString)
+	default:
+		equal := !xNumber && !yNumber && reflect.DeepEqual(a, b)
+
+		switch operator {
+		case "==":
+			return equal
+		case "!=":
+			return !equal
+		}
+
+		return false
+	}
+
+	switch operator {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+
+	return false
+}
+
+// jsonNumber returns a decoded JSON number with all its precision.
+func jsonNumber(value any) (*big.Float, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		number, ok := new(big.Float).SetString(string(v))
+		return number, ok
+	case float64:
+		if math.IsNaN(v) {
+			return nil, false
+		}
+		return big.NewFloat(v), true
+	}
+
+	return nil, false
+}
+
+// jsonChildren returns the children of an array, or the values of an object sorted by key.
+func jsonChildren(node any) []any {
+	switch value := node.(type) {
+	case map[string]any:
+		children := make([]any, 0, len(value))
+
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			children = append(children, value[key])
+		}
+
+		return children
+	case []any:
+		return value
+	}
+
+	return nil
+}
+
+// jsonDescendants returns the nodes and all their descendants, each node before its children.
+func jsonDescendants(nodes []any) []any {
+	descendants := []any{}
+
+	for _, node := range nodes {
+		descendants = append(descendants, node)
+		descendants = append(descendants, jsonDescendants(jsonChildren(node))...)
+	}
+
+	return descendants
+}
+
+// selectFrom returns the children of a node selected by the token.
+func (token *jsonPathToken) selectFrom(node any) []any {
+	switch {
+	case token.filter != nil:
+		selected := []any{}
+
+		for _, child := range jsonChildren(node) {
+			if token.filter.matches(child) {
+				selected = append(selected, child)
+			}
+		}
+
+		return selected
+	case token.wildcard:
+		return jsonChildren(node)
+	case token.isIndex:
+		value, ok := node.([]any)
+		if !ok {
+			return nil
+		}
+
+		index := token.index
+		if index < 0 {
+			index += len(value)
+		}
+
+		if index >= 0 && index < len(value) {
+			return []any{value[index]}
+		}
+	default:
+		value, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		if child, ok := value[token.key]; ok {
+			return []any{child}
+		}
+	}
+
+	return nil
+}
+
+// evalJSONPath applies the selectors of a JSONPath expression to a node.
+func evalJSONPath(data any, tokens []jsonPathToken) []any {
+	current := []any{data}
+
+	for _, token := range tokens {
+		nodes := current
+
+		if token.recursive {
+			nodes = jsonDescendants(current)
+		}
+
+		next := []any{}
+
+		for _, node := range nodes {
+			next = append(next, token.selectFrom(node)...)
+		}
+
+		current = next
+	}
+
+	return current
+}
+
+// ValidateJSONPath checks if a JSONPath expression is valid.
+func ValidateJSONPath(path string) error {
+	_, err := parseJSONPath(path)
+	return err
+}
+
+// JSONPath evaluates a JSONPath expression against decoded JSON data and returns all matches.
+// Supported selectors are child keys (.key or ['key']), array indexes ([0], [-1]), wildcards (.* or [*]),
+// recursive descent (..key or ..[0]) and filters with one comparison ([?(@.status == 'up')] or [?(@.id)]).
+// The children of an object are visited sorted by key.
+func JSONPath(data any, path string) ([]any, error) {
+	tokens, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return evalJSONPath(data, tokens), nil
+}
+
+// decodeJSON decodes a JSON document, keeping the numbers as json.Number so big integers don't lose
+// precision.
+func decodeJSON(b []byte) (any, error) {
+	var data any
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid data after the JSON document")
+	}
+
+	return data, nil
+}
+
+// JSONPathFromBytes decodes a JSON document and evaluates a JSONPath expression against it.
+// The numbers are returned as json.Number.
+func JSONPathFromBytes(b []byte, path string) ([]any, error) {
+	data, err := decodeJSON(b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return JSONPath(data, path)
+}
+
+// JSONValueToString converts a decoded JSON value to its string representation.
+// Strings are returned unquoted and other values are JSON encoded.
+func JSONValueToString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return "null"
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(b)
+}
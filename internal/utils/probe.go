@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// ProbeFamilies probes the first resolved address of each family.
+	ProbeFamilies = "families"
+	// ProbeIPs probes every resolved address.
+	ProbeIPs = "ips"
+
+	// FamilyIPv4 is the family of the IPv4 addresses.
+	FamilyIPv4 = "ipv4"
+	// FamilyIPv6 is the family of the IPv6 addresses.
+	FamilyIPv6 = "ipv6"
+)
+
+// ProbeModes are the allowed probe modes.
+var ProbeModes = []string{ProbeFamilies, ProbeIPs}
+
+// IPFamily returns the family of an IP address.
+func IPFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return FamilyIPv4
+	}
+
+	return FamilyIPv6
+}
+
+// ResolveProbeTargets resolves a host and returns the addresses to probe, depending on the mode.
+func ResolveProbeTargets(ctx context.Context, host, mode string) ([]net.IP, error) {
+	var ips []net.IP
+
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	if mode == ProbeIPs {
+		return ips, nil
+	}
+
+	targets := []net.IP{}
+	seen := map[string]bool{}
+
+	for _, ip := range ips {
+		if family := IPFamily(ip); !seen[family] {
+			seen[family] = true
+			targets = append(targets, ip)
+		}
+	}
+
+	return targets, nil
+}
+
+// CheckRequiredFamilies returns an error if one of the required families, separated by commas, has no
+// reachable address.
+func CheckRequiredFamilies(required string, reachable map[string]bool) error {
+	unreachable := []string{}
+
+	for _, family := range strings.Split(required, ",") {
+		family = strings.ToLower(strings.TrimSpace(family))
+
+		if family != "" && !reachable[family] {
+			unreachable = append(unreachable, family)
+		}
+	}
+
+	if len(unreachable) > 0 {
+		return fmt.Errorf("%s unreachable", strings.Join(unreachable, ", "))
+	}
+
+	return nil
+}
+
+// ValidateFamilies checks a list of families separated by commas.
+func ValidateFamilies(families string) error {
+	for _, family := range strings.Split(families, ",") {
+		family = strings.ToLower(strings.TrimSpace(family))
+
+		if family != FamilyIPv4 && family != FamilyIPv6 {
+			return fmt.Errorf("unknown family %s, expected %s or %s", family, FamilyIPv4, FamilyIPv6)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs returns the functions available in sample templates.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"contains":  strings.Contains,
+		"hasPrefix": strings.HasPrefix,
+		"hasSuffix": strings.HasSuffix,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"matches": func(pattern, s string) (bool, error) {
+			return regexp.MatchString(pattern, s)
+		},
+		"toInt": func(s string) (int64, error) {
+			return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		},
+		"toFloat": func(s string) (float64, error) {
+			return strconv.ParseFloat(strings.TrimSpace(s), 64)
+		},
+	}
+}
+
+// ValidateTemplate checks if a sample template can be parsed.
+func ValidateTemplate(text string) error {
+	_, err := template.New("").Funcs(TemplateFuncs()).Parse(text)
+	return err
+}
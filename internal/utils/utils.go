@@ -9,6 +9,7 @@ import (
 	"os"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -44,7 +45,10 @@ func SetLogLevelFromStr(level string) {
 	log.Debug("Log level set to: ", level)
 }
 
-// AutoDiscoverYML find yaml in given path
+// SampleDefaultsFileNames are the names of the files with the defaults of the samples of a directory.
+var SampleDefaultsFileNames = []string{"_defaults.yml", "_defaults.yaml"}
+
+// AutoDiscoverYML find yaml in given path, skipping the samples defaults files
 func AutoDiscoverYML(path string) ([]string, error) {
 	filesPath := []string{}
 	files, err := os.ReadDir(path)
@@ -61,6 +65,9 @@ func AutoDiscoverYML(path string) ([]string, error) {
 
 			filesPath = append(filesPath, dirFiles...)
 		}
+		if slices.Contains(SampleDefaultsFileNames, f.Name()) {
+			continue
+		}
 		if strings.HasSuffix(f.Name(), ".yml") || strings.HasSuffix(f.Name(), ".yaml") {
 			filesPath = append(filesPath, path+"/"+f.Name())
 		}
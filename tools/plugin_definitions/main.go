@@ -2,10 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"os"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/hidracloud/hidra/v3/internal/plugins"
 	_ "github.com/hidracloud/hidra/v3/internal/plugins/all"
+	"github.com/hidracloud/hidra/v3/internal/plugins/external"
 )
 
 type Plugin2Dump struct {
@@ -15,6 +20,17 @@ type Plugin2Dump struct {
 }
 
 func main() {
+	pluginsPath := flag.String("plugins-path", "", "Path to the external plugins")
+	flag.Parse()
+
+	if *pluginsPath != "" {
+		err := external.LoadPlugins(*pluginsPath)
+		if err != nil {
+			panic(err)
+		}
+
+		defer external.StopPlugins()
+	}
 
 	allPlugins := plugins.GetPlugins()
 
@@ -30,9 +46,23 @@ func main() {
 		plugins2dump = append(plugins2dump, plugin2Dump)
 	}
 
+	// sort the plugins, so the output only changes when the definitions do
+	sort.Slice(plugins2dump, func(i, j int) bool {
+		return plugins2dump[i].Name < plugins2dump[j].Name
+	})
+
 	for _, plugin := range plugins2dump {
 		readmeTxt := "# " + plugin.Name + "\n" + plugin.Description + "\n## Available actions\n"
-		for _, step := range plugin.StepDefinitions {
+		stepNames := make([]string, 0, len(plugin.StepDefinitions))
+
+		for name := range plugin.StepDefinitions {
+			stepNames = append(stepNames, name)
+		}
+
+		slices.Sort(stepNames)
+
+		for _, name := range stepNames {
+			step := plugin.StepDefinitions[name]
 			readmeTxt += "### " + step.Name + "\n" + step.Description + "\n"
 			readmeTxt += "#### Parameters\n"
 			for _, param := range step.Params {
@@ -41,7 +71,21 @@ func main() {
 				if param.Optional {
 					optional = " (optional) "
 				}
-				readmeTxt += "- " + optional + param.Name + ": " + param.Description + "\n"
+				details := ""
+
+				if param.Type != "" {
+					details += " Type: " + string(param.Type) + "."
+				}
+
+				if len(param.AllowedValues) > 0 {
+					details += " Allowed values: " + strings.Join(param.AllowedValues, ", ") + "."
+				}
+
+				if param.Default != "" {
+					details += " Default: " + param.Default + "."
+				}
+
+				readmeTxt += "- " + optional + param.Name + ": " + param.Description + details + "\n"
 			}
 		}
 